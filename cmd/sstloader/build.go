@@ -0,0 +1,87 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"sstloader/internal/build"
+	"sstloader/internal/cassandra"
+)
+
+// buildSSTables write sstables of a table from a csv or ndjson file.
+func buildSSTables(args []string) {
+	var opts struct {
+		File       string `short:"f" long:"file" description:"csv file with a header line, or ndjson file" required:"true"`
+		Format     string `long:"format" description:"input format, csv or json (default: from file extension)"`
+		Schema     string `long:"schema" description:"table schema file (CREATE TABLE)" required:"true"`
+		Out        string `short:"o" long:"output" description:"sstables directory" default:"."`
+		Generation int    `long:"generation" description:"generation of the first sstable" default:"1"`
+		SizeMB     int    `long:"sstable-mb" description:"values MiB sorted in memory and written by sstable" default:"256"`
+		WriteTime  string `long:"writetime" description:"write time of the rows of the first sstable, 1 microsecond later by next one (RFC3339 or microseconds since epoch, default: now)"`
+		TTL        int    `long:"ttl" description:"ttl of the rows in seconds, 0 for none"`
+
+		Log logOptions `group:"Logging Options"`
+	}
+
+	parse("sstloader build", &opts, args)
+	lg := opts.Log.logging()
+	log := lg.Logger("main")
+
+	read := build.ReadCSV
+	format := opts.Format
+	if format == "" {
+		format = strings.TrimPrefix(filepath.Ext(opts.File), ".")
+	}
+	switch format {
+	case "csv":
+	case "json", "ndjson", "jsonl":
+		read = build.ReadNDJSON
+	default:
+		log.Error("input format: expected csv or json", "format", format)
+		os.Exit(1)
+	}
+
+	table, err := cassandra.ReadSchemaFile(opts.Schema)
+	if err != nil {
+		log.Error("read schema", "error", err)
+		os.Exit(1)
+	}
+	b, err := build.New(table)
+	if err != nil {
+		log.Error("table schema", "table", table.Keyspace+"."+table.Name, "error", err)
+		os.Exit(1)
+	}
+	b.Dir = opts.Out
+	b.Generation = opts.Generation
+	b.MaxBytes = int64(opts.SizeMB) << 20
+	b.TTL = int64(opts.TTL)
+	b.Logger = lg.Logger("build")
+	if opts.WriteTime != "" {
+		b.Timestamp, err = parseWriteTime(opts.WriteTime)
+		if err != nil {
+			log.Error("write time", "error", err)
+			os.Exit(1)
+		}
+	}
+
+	err = os.MkdirAll(opts.Out, 0755)
+	if err != nil {
+		log.Error("output directory", "error", err)
+		os.Exit(1)
+	}
+
+	start := time.Now()
+	err = read(opts.File, b.Add)
+	if err == nil {
+		err = b.Flush()
+	}
+	if err != nil {
+		log.Error("build", "file", opts.File, "error", err)
+		os.Exit(1)
+	}
+
+	fmt.Printf("%d records, %d rows written to %d sstables in %s.\n", b.Records, b.Rows, b.SSTables, time.Since(start))
+}
@@ -1,40 +1,84 @@
 package main
 
 import (
+	"context"
 	"fmt"
+	"log/slog"
+	"maps"
+	"math"
 	"os"
+	"os/signal"
+	"regexp"
+	"slices"
+	"strconv"
 	"strings"
 	"sync"
+	"syscall"
 	"time"
 
 	"github.com/jessevdk/go-flags"
 
 	"sstloader/internal/cassandra"
+	"sstloader/internal/checkpoint"
+	"sstloader/internal/logging"
+	"sstloader/internal/metrics"
+	"sstloader/internal/progress"
+	"sstloader/internal/throttle"
 	"sstloader/pkg/sstable"
 )
 
+// cassandra connection options, shared by commands
+type connOptions struct {
+	Seeds    string `short:"s" long:"seeds" description:"cassandra seeds, comma separated host[:port] (required unless dry run)" env:"SSTLOADER_SEEDS"`
+	Port     int    `long:"port" description:"cassandra default port (default: 9042)" env:"SSTLOADER_PORT"`
+	DC       string `short:"r" long:"datacenter" description:"cassandra datacenter" default:"" env:"SSTLOADER_DATACENTER"`
+	Username string `short:"u" long:"username" description:"cassandra username (default: cassandra)" env:"SSTLOADER_USERNAME"`
+	Password string `short:"p" long:"password" description:"cassandra password, over --password-file and the environment (default: $SSTLOADER_PASSWORD, or cassandra)"`
+	PassFile string `long:"password-file" description:"read cassandra password from file, over the environment (default: $SSTLOADER_PASSWORD_FILE)"`
+	Cqlshrc  string `long:"cqlshrc" description:"cqlsh config file for credentials and connection (default: ~/.cassandra/cqlshrc)"`
+	Conns    int    `long:"connections" description:"number of connections by host" default:"20"`
+	Retries  int    `long:"retries" description:"number of retry per query" default:"5"`
+	CL       string `long:"consistency" description:"write consistency level" default:"ANY"`
+	SerialCL string `long:"serial-consistency" description:"write serial consistency level" default:"SERIAL"`
+	Timeout  int    `long:"timeout" description:"timeout of a query in ms" default:"5000"`
+	Compress bool   `long:"compress" description:"compress cql queries"`
+
+	SSL           bool   `long:"ssl" description:"connect with tls, the server certificate is only checked with --ssl-ca or --ssl-verify-host"`
+	SSLCA         string `long:"ssl-ca" description:"tls ca file to verify server certificate" env:"SSTLOADER_SSL_CA"`
+	SSLCert       string `long:"ssl-cert" description:"tls client certificate file" env:"SSTLOADER_SSL_CERT"`
+	SSLKey        string `long:"ssl-key" description:"tls client key file" env:"SSTLOADER_SSL_KEY"`
+	SSLServerName string `long:"ssl-server-name" description:"tls server name (default: host name)"`
+	SSLVerifyHost bool   `long:"ssl-verify-host" description:"verify server name against its certificate"`
+
+	DeadLetter string `long:"deadletter" description:"write failed rows to this file"`
+}
+
+// logging options, shared by commands
+type logOptions struct {
+	Debug  bool   `long:"debug" description:"print debugging messages (as --log-level debug)"`
+	Level  string `long:"log-level" description:"log level, with per component levels (main, sstable, cassandra, checkpoint, metrics, build) as info,sstable=debug" default:"info"`
+	Format string `long:"log-format" description:"log format, text or json" default:"text"`
+}
+
 func main() {
-	var opts struct {
-		DataFile string `short:"d" long:"datafile" description:"sstable data file" required:"true"`
-		Seeds    string `short:"s" long:"seeds" description:"cassandra seeds" required:"true"`
-		KS       string `short:"k" long:"keyspace" description:"cassandra keyspace" required:"true"`
-		Table    string `short:"t" long:"table" description:"cassandra table" required:"true"`
-		DC       string `short:"r" long:"datacenter" description:"cassandra datacenter" default:""`
-		Username string `short:"u" long:"username" description:"cassandra username" default:"cassandra"`
-		Password string `short:"p" long:"password" description:"cassandra password" default:"cassandra"`
-		Workers  int    `short:"w" long:"workers" description:"workers numbers" default:"100"`
-		InFlight int    `short:"i" long:"maxinflight" description:"maximum in flight requests" default:"200"`
-		Limit    int    `short:"l" long:"ratelimit" description:"rate limit insert per second" default:"10000"`
-		Conns    int    `long:"connections" description:"number of connections by host" default:"20"`
-		Dry      bool   `long:"dryrun" description:"only decode sstable"`
-		Retries  int    `long:"retries" description:"number of retry per query" default:"5"`
-		Timeout  int    `long:"timeout" description:"timeout of a query in ms" default:"5000"`
-		Sampling int    `long:"sample" description:"every how many qyeries print message rate" default:"10000"`
-		Compress bool   `long:"compress" description:"compress cql queries"`
-		Debug    bool   `long:"debug" description:"print debugging messages"`
-	}
-
-	if _, err := flags.Parse(&opts); err != nil {
+	// subcommands, loading by default
+	if len(os.Args) > 1 && os.Args[1] == "replay" {
+		replay(os.Args[2:])
+		return
+	}
+	if len(os.Args) > 1 && os.Args[1] == "build" {
+		buildSSTables(os.Args[2:])
+		return
+	}
+
+	load(os.Args[1:])
+}
+
+func parse(name string, opts any, args []string) {
+	parser := flags.NewParser(opts, flags.Default)
+	parser.Name = name
+
+	if _, err := parser.ParseArgs(args); err != nil {
 		switch flagsErr := err.(type) {
 		case flags.ErrorType:
 			if flagsErr == flags.ErrHelp {
@@ -45,76 +89,558 @@ func main() {
 			os.Exit(1)
 		}
 	}
+}
 
-	// sstable init
-	sst := sstable.New()
-	sst.DataFile = opts.DataFile
-	sst.StatisticsFile = strings.Replace(opts.DataFile, "Data", "Statistics", 1)
-	sst.CompressionFile = strings.Replace(opts.DataFile, "Data", "CompressionInfo", 1)
-	sst.Limit = opts.Limit
-	sst.Sampling = opts.Sampling
+// logging return the loggers from logging options, logs go to stderr.
+func (opts *logOptions) logging() *logging.Logging {
+	levels := opts.Level
 	if opts.Debug {
-		sst.Debug = true
+		levels += ",debug"
 	}
 
-	// read statistics file
-	err := sst.ReadStatistics()
+	lg, err := logging.New(os.Stderr, opts.Format, levels)
 	if err != nil {
-		fmt.Printf("(error) read statistics: %v\n", err)
+		fmt.Fprintf(os.Stderr, "%v\n", err)
 		os.Exit(1)
 	}
 
-	// cassandra loader init
+	return lg
+}
+
+// loader return a cassandra loader from connection options.
+func (opts *connOptions) loader(lg *logging.Logging) (*cassandra.CassandraLoader, error) {
 	cl := cassandra.New()
+	cl.Logger = lg.Logger("cassandra")
 	cl.Seeds = opts.Seeds
-	cl.KS = opts.KS
-	cl.Table = opts.Table
+	cl.Port = opts.Port
 	cl.DC = opts.DC
 	cl.Username = opts.Username
 	cl.Password = opts.Password
 	cl.Timeout = opts.Timeout
 	cl.Retries = opts.Retries
 	cl.Conns = opts.Conns
+	cl.Consistency = opts.CL
+	cl.SerialConsistency = opts.SerialCL
 	cl.Compress = opts.Compress
-	if opts.Debug {
-		cl.Debug = true
+	cl.TLS = cassandra.TLS{
+		Enabled:    opts.SSL || opts.SSLCA != "" || opts.SSLCert != "",
+		CA:         opts.SSLCA,
+		Cert:       opts.SSLCert,
+		Key:        opts.SSLKey,
+		ServerName: opts.SSLServerName,
+		VerifyHost: opts.SSLVerifyHost,
+	}
+
+	// password flags win over the environment, a password over a password file
+	passFile := opts.PassFile
+	if cl.Password == "" && passFile == "" {
+		cl.Password = os.Getenv("SSTLOADER_PASSWORD")
+		passFile = os.Getenv("SSTLOADER_PASSWORD_FILE")
+	}
+
+	// credentials and connection settings not given by flags or environment
+	if passFile != "" {
+		err := cl.ReadPasswordFile(passFile)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	var err error
+	if opts.Cqlshrc != "" {
+		err = cl.ReadCqlshrc(opts.Cqlshrc, true)
+	} else {
+		err = cl.ReadCqlshrc(cassandra.DefaultCqlshrc(), false)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	if cl.Username == "" {
+		cl.Username = "cassandra"
+	}
+	if cl.Password == "" {
+		cl.Password = "cassandra"
+	}
+
+	if opts.DeadLetter != "" {
+		cl.DeadLetter, err = cassandra.OpenDeadLetter(opts.DeadLetter)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return cl, nil
+}
+
+// summary print failures by error class.
+func summary(out *os.File, cl *cassandra.CassandraLoader, log *slog.Logger) {
+	failures := cl.Failures.Counts()
+	for _, class := range slices.Sorted(maps.Keys(failures)) {
+		fmt.Fprintf(out, "  %s: %d failed\n", class, failures[class])
+	}
+
+	if cl.DeadLetter != nil {
+		err := cl.DeadLetter.Close()
+		if err != nil {
+			log.Error("dead-letter", "error", err)
+		}
+	}
+}
+
+func load(args []string) {
+	var opts struct {
+		DataFile []string `short:"d" long:"datafile" description:"sstable data file, repeat to load several sstables of the table" required:"true"`
+		KS       string   `short:"k" long:"keyspace" description:"cassandra keyspace (default: from schema file)"`
+		Table    string   `short:"t" long:"table" description:"cassandra table (default: from schema file)"`
+		Workers  int      `short:"w" long:"workers" description:"workers numbers" default:"100"`
+		InFlight int      `short:"i" long:"maxinflight" description:"maximum in flight requests" default:"200"`
+		Limit    int      `short:"l" long:"ratelimit" description:"rate limit insert per second, 0 for none" default:"10000"`
+		Adaptive bool     `long:"adaptive" description:"adapt the rate limit to the cluster backpressure, starting from --ratelimit"`
+		Batch    int      `long:"batch" description:"max rows of a partition per unlogged batch" default:"1"`
+		BatchKB  int      `long:"batch-kb" description:"max size of an unlogged batch in KiB" default:"50"`
+		Dry      bool     `long:"dryrun" description:"only decode sstable"`
+		Print    bool     `long:"print" description:"print decoded rows as json instead of loading them (needs --schema)"`
+		SchemaCL string   `long:"schema-consistency" description:"consistency level of the table schema query" default:"LOCAL_QUORUM"`
+		Sampling int      `long:"sample" description:"every how many qyeries print message rate" default:"10000"`
+		Metrics  string   `long:"metrics" description:"expose prometheus metrics on this address (as :9180)"`
+		Progress int      `long:"progress" description:"seconds between progress lines when stderr is not a terminal, 0 to disable" default:"10"`
+		Force    bool     `long:"force" description:"load even if sstable and table schemas are incompatible"`
+		Schema   string   `long:"schema" description:"table schema file (CREATE TABLE) instead of reading it from the cluster"`
+
+		LimitKB         int  `long:"ratelimit-kb" description:"rate limit of bound values KiB per second, alone or with --ratelimit"`
+		LimitKBWorker   bool `long:"ratelimit-kb-per-worker" description:"split the --ratelimit-kb limit across workers instead of the whole process"`
+		AdaptiveMin     int  `long:"adaptive-min" description:"lowest adaptive rate limit" default:"100"`
+		AdaptiveMax     int  `long:"adaptive-max" description:"highest adaptive rate limit (default: unlimited)"`
+		AdaptiveLatency int  `long:"adaptive-latency" description:"p99 query latency in ms over which the adaptive rate is decreased" default:"500"`
+
+		Keys       string `long:"keys" description:"only load the partition keys of this file, one per line with components separated by ':'"`
+		StartToken int64  `long:"start-token" description:"only load partitions with a token greater than this one" default:"-9223372036854775808"`
+		EndToken   int64  `long:"end-token" description:"only load partitions with a token lower or equal to this one" default:"9223372036854775807"`
+		KeyRegexp  string `long:"key-regexp" description:"only load partition keys matching this regular expression"`
+		MinWrite   string `long:"min-writetime" description:"only load data written at or after this time (RFC3339 or microseconds since epoch)"`
+		MaxWrite   string `long:"max-writetime" description:"only load data written at or before this time (RFC3339 or microseconds since epoch)"`
+		KeepExp    bool   `long:"keep-expired" description:"load rows and cells whose ttl elapsed (as for forensic exports)"`
+		Merge      bool   `long:"merge" description:"merge the sstables, loading each row once as last written, with tombstones applied"`
+
+		Checkpoint string `long:"checkpoint" description:"save loading progress to this state file"`
+		Interval   int    `long:"checkpoint-interval" description:"seconds between checkpoints" default:"10"`
+		Resume     bool   `long:"resume" description:"skip data already loaded according to the checkpoint file"`
+
+		Mapping string            `long:"mapping" description:"columns mapping file"`
+		Rename  map[string]string `long:"rename" description:"load sstable column into table column (src=dst)" key-value-delimiter:"="`
+		Drop    []string          `long:"drop" description:"do not load sstable column"`
+		Set     map[string]string `long:"set" description:"set table column to a cql literal (col=literal)" key-value-delimiter:"="`
+
+		Conn connOptions `group:"Cassandra Options"`
+		Log  logOptions  `group:"Logging Options"`
+	}
+
+	parse("sstloader", &opts, args)
+	lg := opts.Log.logging()
+	log := lg.Logger("main")
+
+	if opts.Print {
+		if opts.Schema == "" {
+			log.Error("--print needs a table schema file (--schema)")
+			os.Exit(1)
+		}
+		opts.Dry = true
+	}
+
+	// partitions filter, if any
+	var filter *sstable.Filter
+	if opts.Keys != "" || opts.KeyRegexp != "" || opts.StartToken != math.MinInt64 || opts.EndToken != math.MaxInt64 {
+		filter = &sstable.Filter{
+			Tokens: opts.StartToken != math.MinInt64 || opts.EndToken != math.MaxInt64,
+			Start:  opts.StartToken,
+			End:    opts.EndToken,
+		}
+		if opts.Keys != "" {
+			keys, err := sstable.ReadKeysFile(opts.Keys)
+			if err != nil {
+				log.Error("read keys", "error", err)
+				os.Exit(1)
+			}
+			filter.Keys = keys
+		}
+		if opts.KeyRegexp != "" {
+			re, err := regexp.Compile(opts.KeyRegexp)
+			if err != nil {
+				log.Error("key regexp", "error", err)
+				os.Exit(1)
+			}
+			filter.Regexp = re
+		}
+	}
+
+	// write time window, if any
+	var window *sstable.Window
+	if opts.MinWrite != "" || opts.MaxWrite != "" {
+		window = &sstable.Window{Min: math.MinInt64, Max: math.MaxInt64}
+		var err error
+		if opts.MinWrite != "" {
+			window.Min, err = parseWriteTime(opts.MinWrite)
+		}
+		if err == nil && opts.MaxWrite != "" {
+			window.Max, err = parseWriteTime(opts.MaxWrite)
+		}
+		if err != nil {
+			log.Error("write time", "error", err)
+			os.Exit(1)
+		}
+	}
+
+	// sstables init, all headers are read before loading anything
+	var (
+		ssts  []*sstable.SSTable
+		total int64
+	)
+	configure := func(sst *sstable.SSTable) {
+		sst.Filter = filter
+		sst.WriteTime = window
+		sst.KeepExpired = opts.KeepExp
+		sst.Limit = opts.Limit
+		sst.Sampling = opts.Sampling
+		sst.BatchSize = opts.Batch
+		sst.BatchBytes = opts.BatchKB * 1024
+		sst.Logger = lg.Logger("sstable").With("sstable", sst.DataFile)
+	}
+	for _, file := range opts.DataFile {
+		sst := sstable.New()
+		sst.DataFile = file
+		sst.StatisticsFile = strings.Replace(file, "Data", "Statistics", 1)
+		sst.CompressionFile = strings.Replace(file, "Data", "CompressionInfo", 1)
+		sst.IndexFile = strings.Replace(file, "Data", "Index", 1)
+		configure(sst)
+
+		// read statistics file
+		err := sst.ReadStatistics()
+		if err != nil {
+			log.Error("read statistics", "sstable", file, "error", err)
+			os.Exit(1)
+		}
+
+		// all data written out of the window
+		if window != nil && !window.Overlaps(sst.Stats.MinTimestamp, sst.Stats.MaxTimestamp) {
+			log.Info("skip sstable out of write time window", "sstable", file, "window", window.String())
+			continue
+		}
+
+		// read compression file for the data length
+		err = sst.ReadCompressionInfo()
+		if err != nil {
+			log.Error("read compression info", "sstable", file, "error", err)
+			os.Exit(1)
+		}
+
+		ssts = append(ssts, sst)
+	}
+	if len(ssts) == 0 {
+		log.Info("no sstable to load")
+		return
+	}
+
+	// one reconciled sstable, positions in the merge are not resumable
+	if opts.Merge {
+		if opts.Checkpoint != "" {
+			log.Error("--merge cannot be used with a checkpoint file (--checkpoint)")
+			os.Exit(1)
+		}
+		merged, err := sstable.NewMerge(ssts)
+		if err != nil {
+			log.Error("merge", "error", err)
+			os.Exit(1)
+		}
+		configure(merged)
+		ssts = []*sstable.SSTable{merged}
+	}
+
+	// cassandra loader init
+	cl, err := opts.Conn.loader(lg)
+	if err != nil {
+		log.Error("cassandra loader", "error", err)
+		os.Exit(1)
+	}
+	cl.KS = opts.KS
+	cl.Table = opts.Table
+	cl.SchemaConsistency = opts.SchemaCL
+	cl.Force = opts.Force
+	cl.Dry = opts.Dry
+	cl.Schema = opts.Schema
+	cl.Mapping = cassandra.Mapping{Rename: opts.Rename, Drop: opts.Drop, Set: opts.Set}
+
+	if opts.Mapping != "" {
+		err := cl.Mapping.ReadFile(opts.Mapping)
+		if err != nil {
+			log.Error("read mapping", "error", err)
+			os.Exit(1)
+		}
+	}
+
+	// offline prepare with a schema file, the first sstable is checked before loading anything
+	prepare := !opts.Dry || opts.Schema != ""
+	if prepare {
+		err := cl.Prepare(ssts[0])
+		if err != nil {
+			log.Error("cassandra loader prepare", "sstable", ssts[0].DataFile, "error", err)
+			os.Exit(1)
+		}
+	}
+
+	// checkpoint, in memory only without file to report the resume position
+	if opts.Resume && opts.Checkpoint == "" {
+		log.Error("--resume needs a checkpoint file (--checkpoint)")
+		os.Exit(1)
 	}
+	cp, err := checkpoint.New(opts.Checkpoint, opts.Resume)
+	if err != nil {
+		log.Error("checkpoint", "error", err)
+		os.Exit(1)
+	}
+	cp.Logger = lg.Logger("checkpoint")
+	for _, sst := range ssts {
+		sst.Start = cp.Offset(sst.DataFile)
+		total += max(sst.DataLength-sst.Start, 0)
+		log.Debug("start", "sstable", sst.DataFile, "offset", sst.Start)
+	}
+	cp.Start(time.Duration(opts.Interval) * time.Second)
+
+	// first signal stop reading and drain in flight queries, second one exit
+	ctx, stop := context.WithCancel(context.Background())
+	defer stop()
+	sigs := make(chan os.Signal, 2)
+	signal.Notify(sigs, syscall.SIGINT, syscall.SIGTERM)
+	go func() {
+		s := <-sigs
+		log.Warn("draining in flight queries (signal again to force exit)", "signal", s.String())
+		stop()
+		<-sigs
+		log.Error("forced exit")
+		os.Exit(1)
+	}()
 
-	if !opts.Dry {
-		err := cl.Prepare(sst)
+	if opts.Metrics != "" {
+		cl.Metrics = metrics.New(cl.KS, cl.Table)
+		cl.Metrics.Logger = lg.Logger("metrics")
+		err = cl.Metrics.Serve(opts.Metrics)
 		if err != nil {
-			fmt.Printf("(error) cassandra loader prepare: %v\n", err)
+			log.Error("metrics", "error", err)
 			os.Exit(1)
 		}
 	}
 
+	// rate limit adapted to the cluster backpressure, shared by all sstables
+	var adaptive *throttle.Adaptive
+	if opts.Adaptive {
+		if opts.Limit <= 0 {
+			log.Error("--adaptive needs a starting --ratelimit")
+			os.Exit(1)
+		}
+		adaptive = throttle.New(float64(opts.Limit))
+		adaptive.Min = float64(opts.AdaptiveMin)
+		if opts.AdaptiveMax > 0 {
+			adaptive.Max = float64(opts.AdaptiveMax)
+		}
+		adaptive.Latency = time.Duration(opts.AdaptiveLatency) * time.Millisecond
+		for _, sst := range ssts {
+			sst.Limiter = adaptive
+		}
+		cl.Throttle = adaptive
+		adaptive.Start()
+		defer adaptive.Stop()
+	}
+
+	// bytes rate limit, for the process as rows are read, or by worker as batches are sent
+	var workerBytes float64
+	if opts.LimitKB > 0 {
+		if opts.LimitKBWorker {
+			workerBytes = float64(opts.LimitKB) * 1024 / float64(opts.Workers)
+		} else {
+			limiter := throttle.NewRate(float64(opts.LimitKB) * 1024)
+			for _, sst := range ssts {
+				sst.BytesLimiter = limiter
+			}
+		}
+	}
+
+	// rows counted over all sstables
+	rows := func() int64 {
+		var n int64
+		for _, sst := range ssts {
+			n += sst.Queries.Load()
+		}
+		return n
+	}
+
+	// progress on stderr, stdout is kept for printed rows
+	var pg *progress.Progress
+	if opts.Progress > 0 {
+		pg = progress.New(os.Stderr, total, time.Duration(opts.Progress)*time.Second, func() progress.Counters {
+			c := progress.Counters{Rows: rows(), Errors: cl.Errors.Load()}
+			for _, sst := range ssts {
+				c.Bytes += max(sst.Position.Load()-sst.Start, 0)
+			}
+			return c
+		})
+		if adaptive != nil {
+			pg.Extra = func() string { return fmt.Sprintf("rate %.0f/s", adaptive.Rate()) }
+		}
+	}
+
+	// main reading loop, one sstable after the other
+	start := time.Now()
+	if pg != nil {
+		pg.Start()
+	}
+	current := ssts[0]
+	failed := false
+	for i, sst := range ssts {
+		if ctx.Err() != nil {
+			break
+		}
+		current = sst
+
+		// the insert query depends on the sstable columns
+		if prepare && i > 0 {
+			err := cl.Prepare(sst)
+			if err != nil {
+				log.Error("cassandra loader prepare", "sstable", sst.DataFile, "error", err)
+				failed = true
+				break
+			}
+		}
+
+		ch := make(chan sstable.Batch, opts.InFlight)
+		if cl.Metrics != nil {
+			cl.Metrics.SSTable(sst, ch)
+		}
+		err := loadSSTable(ctx, sst, ch, cl, cp, workerOptions{
+			Workers: opts.Workers,
+			Print:   opts.Print,
+			Dry:     opts.Dry,
+			Bytes:   workerBytes,
+		}, log)
+		if err != nil {
+			// the other sstables are still loaded
+			log.Error("read data", "sstable", sst.DataFile, "error", err)
+			failed = true
+		}
+	}
+	if pg != nil {
+		pg.Stop()
+	}
+
+	elapsed := time.Since(start)
+	err = cp.Stop()
+	if err != nil {
+		log.Error("checkpoint", "error", err)
+	}
+
+	// keep stdout for printed rows
+	out := os.Stdout
+	if opts.Print {
+		out = os.Stderr
+	}
+	fmt.Fprintf(out, "%d rows inserted in %s. (%d rows/s). %d failed\n", rows(), elapsed, progress.Rate(rows(), elapsed), cl.Errors.Load())
+	var outOfWindow, expiredRows, expiredCells, deleted int64
+	for _, sst := range ssts {
+		outOfWindow += sst.OutOfWindow.Load()
+		expiredRows += sst.ExpiredRows.Load()
+		expiredCells += sst.ExpiredCells.Load()
+		deleted += sst.Deleted.Load()
+	}
+	if opts.Merge {
+		fmt.Fprintf(out, "  %d rows removed by tombstones\n", deleted)
+	}
+	if window != nil {
+		fmt.Fprintf(out, "  %d rows out of write time window\n", outOfWindow)
+	}
+	if !opts.KeepExp {
+		fmt.Fprintf(out, "  %d expired rows skipped, %d expired cells unset\n", expiredRows, expiredCells)
+	}
+	summary(out, cl, log)
+
+	if ctx.Err() != nil && opts.Merge {
+		fmt.Fprintf(out, "interrupted after %d merged partitions\n", cp.Offset(current.DataFile))
+		os.Exit(1)
+	}
+	if ctx.Err() != nil {
+		fmt.Fprintf(out, "interrupted, resume position: %s at offset %d\n", current.DataFile, cp.Offset(current.DataFile))
+		os.Exit(1)
+	}
+	if failed {
+		os.Exit(1)
+	}
+}
+
+// parseWriteTime return microseconds since epoch of a RFC3339 time or a number of microseconds.
+func parseWriteTime(s string) (int64, error) {
+	if us, err := strconv.ParseInt(s, 10, 64); err == nil {
+		return us, nil
+	}
+	t, err := time.Parse(time.RFC3339Nano, s)
+	if err != nil {
+		return 0, fmt.Errorf("invalid time %q: expected RFC3339 or microseconds", s)
+	}
+	return t.UnixMicro(), nil
+}
+
+// loader workers options
+type workerOptions struct {
+	Workers int
+	Print   bool    // print rows instead of loading them
+	Dry     bool    // do nothing of rows
+	Bytes   float64 // values bytes per second by worker, 0 for none
+}
+
+// loadSSTable read the partitions of an sstable and load them with a pool of workers,
+// nothing is loaded if its data cannot be read.
+func loadSSTable(ctx context.Context, sst *sstable.SSTable, ch chan sstable.Batch, cl *cassandra.CassandraLoader, cp *checkpoint.Checkpoint, opts workerOptions, log *slog.Logger) error {
 	// read datafile and uncompress it in memory
-	err = sst.ReadData()
+	defer sst.Close()
+	err := sst.ReadData()
 	if err != nil {
-		fmt.Printf("(error) read data: %v\n", err)
+		return err
 	}
 
 	// loader workers
-	ch := make(chan []any, opts.InFlight)
 	wg := &sync.WaitGroup{}
 	wg.Add(opts.Workers)
 	for i := 0; i < opts.Workers; i++ {
 		go func() {
 			defer wg.Done()
-			for v := range ch {
-				if !opts.Dry {
-					cl.Load(v)
+			var limiter *throttle.Rate
+			if opts.Bytes > 0 {
+				limiter = throttle.NewRate(opts.Bytes)
+			}
+			for b := range ch {
+				if limiter != nil {
+					limiter.TakeN(b.Bytes)
+				}
+
+				var err error
+				switch {
+				case opts.Print:
+					for _, v := range b.Rows {
+						err = cl.Print(os.Stdout, v)
+						if err != nil {
+							log.Error("print", "sstable", b.Source, "key", b.Key, "error", err)
+							break
+						}
+					}
+				case !opts.Dry:
+					err = cl.Load(b)
 				}
+
+				cp.Done(&b, err == nil)
 			}
 		}()
 	}
 
-	// main reading lopp
-	start := time.Now()
-	sst.ReadPartitions(ch)
+	sst.ReadPartitions(ctx, ch)
 	close(ch)
-
 	wg.Wait()
-	elapsed := time.Since(start)
-	fmt.Printf("%d rows inserted in %s. (%d rows/s). %d failed\n", sst.Queries, elapsed, sst.Queries/int(elapsed.Seconds()), cl.Errors.Load())
+
+	return nil
 }
@@ -0,0 +1,72 @@
+package main
+
+import (
+	"io"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/jessevdk/go-flags"
+
+	"sstloader/internal/logging"
+)
+
+func TestPassword(t *testing.T) {
+	dir := t.TempDir()
+	file := filepath.Join(dir, "password")
+	err := os.WriteFile(file, []byte("from file\n"), 0600)
+	if err != nil {
+		t.Fatal(err)
+	}
+	envFile := filepath.Join(dir, "env-password")
+	err = os.WriteFile(envFile, []byte("from env file\n"), 0600)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name     string
+		args     []string
+		env      map[string]string
+		password string
+	}{
+		{"default", nil, nil, "cassandra"},
+		{"flag", []string{"-p", "from flag"}, nil, "from flag"},
+		{"flag over file", []string{"-p", "from flag", "--password-file", file}, nil, "from flag"},
+		{"file", []string{"--password-file", file}, nil, "from file"},
+		{"environment", nil, map[string]string{"SSTLOADER_PASSWORD": "from env"}, "from env"},
+		{"environment file", nil, map[string]string{"SSTLOADER_PASSWORD_FILE": envFile}, "from env file"},
+		{"environment over environment file", nil, map[string]string{"SSTLOADER_PASSWORD": "from env", "SSTLOADER_PASSWORD_FILE": envFile}, "from env"},
+		{"flag over environment", []string{"-p", "from flag"}, map[string]string{"SSTLOADER_PASSWORD": "from env"}, "from flag"},
+		{"file over environment", []string{"--password-file", file}, map[string]string{"SSTLOADER_PASSWORD": "from env", "SSTLOADER_PASSWORD_FILE": envFile}, "from file"},
+	}
+
+	lg, err := logging.New(io.Discard, "text", "info")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			// no cqlshrc
+			t.Setenv("HOME", t.TempDir())
+			t.Setenv("SSTLOADER_PASSWORD", "")
+			t.Setenv("SSTLOADER_PASSWORD_FILE", "")
+			for k, v := range test.env {
+				t.Setenv(k, v)
+			}
+
+			var opts connOptions
+			_, err := flags.ParseArgs(&opts, test.args)
+			if err != nil {
+				t.Fatal(err)
+			}
+			cl, err := opts.loader(lg)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if cl.Password != test.password {
+				t.Errorf("password %q, want %q", cl.Password, test.password)
+			}
+		})
+	}
+}
@@ -0,0 +1,87 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"sync"
+	"time"
+
+	"go.uber.org/ratelimit"
+
+	"sstloader/internal/cassandra"
+)
+
+// replay command options
+type replayOptions struct {
+	File    string `short:"f" long:"file" description:"dead-letter file to replay" required:"true"`
+	Workers int    `short:"w" long:"workers" description:"workers numbers" default:"100"`
+	Limit   int    `short:"l" long:"ratelimit" description:"rate limit insert per second, 0 for none" default:"10000"`
+
+	Conn connOptions `group:"Cassandra Options"`
+	Log  logOptions  `group:"Logging Options"`
+}
+
+// replay re-submit the rows of a dead-letter file.
+func replay(args []string) {
+	var opts replayOptions
+	parse("sstloader replay", &opts, args)
+	lg := opts.Log.logging()
+	log := lg.Logger("main")
+
+	if opts.Conn.DeadLetter == opts.File {
+		log.Error("replayed rows can't fail into the replayed file")
+		os.Exit(1)
+	}
+
+	cl, err := opts.Conn.loader(lg)
+	if err != nil {
+		log.Error("cassandra loader", "error", err)
+		os.Exit(1)
+	}
+
+	err = cl.Connect()
+	if err != nil {
+		log.Error("cassandra connect", "error", err)
+		os.Exit(1)
+	}
+
+	start := time.Now()
+	rows, err := replayFile(cl, &opts)
+	if err != nil {
+		log.Error("replay", "file", opts.File, "error", err)
+	}
+
+	fmt.Printf("%d rows replayed in %s. %d failed\n", rows, time.Since(start), cl.Errors.Load())
+	summary(os.Stdout, cl, log)
+}
+
+// replayFile send the records of the dead-letter file to replay workers, return the records read.
+func replayFile(cl *cassandra.CassandraLoader, opts *replayOptions) (int, error) {
+	ch := make(chan *cassandra.Record, opts.Workers)
+	wg := &sync.WaitGroup{}
+	wg.Add(opts.Workers)
+	for i := 0; i < opts.Workers; i++ {
+		go func() {
+			defer wg.Done()
+			for r := range ch {
+				cl.Replay(r)
+			}
+		}()
+	}
+
+	rl := ratelimit.NewUnlimited()
+	if opts.Limit > 0 {
+		rl = ratelimit.New(opts.Limit)
+	}
+	rows := 0
+	err := cassandra.ReadDeadLetters(opts.File, func(r *cassandra.Record) error {
+		rl.Take()
+		ch <- r
+		rows++
+		return nil
+	})
+	close(ch)
+	wg.Wait()
+
+	return rows, err
+}
@@ -0,0 +1,91 @@
+package main
+
+import (
+	"io"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/jessevdk/go-flags"
+
+	"sstloader/internal/cassandra"
+	"sstloader/internal/logging"
+)
+
+func TestReplay(t *testing.T) {
+	dir := t.TempDir()
+	file := filepath.Join(dir, "dl.json")
+	out := filepath.Join(dir, "replayed.json")
+
+	dl, err := cassandra.OpenDeadLetter(file)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, key := range []string{"a", "b", "c"} {
+		err = dl.Write(&cassandra.Record{
+			Query:  "INSERT INTO ks.t (id,v) VALUES (?,?)",
+			Values: cassandra.EncodeValues([]any{key, int32(1)}),
+			Class:  "write_timeout/ONE",
+			Key:    key,
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	err = dl.Close()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// options as given on the command line, unthrottled, with no server listening
+	var opts replayOptions
+	_, err = flags.ParseArgs(&opts, []string{"-f", file, "-s", "127.0.0.1:1", "--deadletter", out, "--ratelimit", "0", "-w", "2"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	lg, err := logging.New(io.Discard, "text", "info")
+	if err != nil {
+		t.Fatal(err)
+	}
+	cl, err := opts.Conn.loader(lg)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// the connection fails on the cluster, not on the options
+	err = cl.Connect()
+	if err == nil {
+		t.Fatal("connected without server")
+	}
+	if strings.Contains(err.Error(), "consistency") {
+		t.Fatalf("connect: %v", err)
+	}
+
+	// every record fails again into the dead-letter file
+	rows, err := replayFile(cl, &opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = cl.DeadLetter.Close()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if rows != 3 || cl.Errors.Load() != 3 {
+		t.Errorf("%d rows replayed, %d failed, want 3 and 3", rows, cl.Errors.Load())
+	}
+
+	var keys []string
+	err = cassandra.ReadDeadLetters(out, func(r *cassandra.Record) error {
+		if r.Class != "no_connections" || r.Query != "INSERT INTO ks.t (id,v) VALUES (?,?)" || len(r.Values) != 2 {
+			t.Errorf("replayed record %+v", r)
+		}
+		keys = append(keys, r.Key)
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(keys) != 3 {
+		t.Errorf("replayed records of keys %v, want a, b and c", keys)
+	}
+}
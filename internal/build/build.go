@@ -0,0 +1,286 @@
+package build
+
+import (
+	"errors"
+	"fmt"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"slices"
+	"sort"
+	"strings"
+	"time"
+
+	"sstloader/internal/cassandra"
+	"sstloader/pkg/sstable"
+)
+
+// Builder write records of a table to sstables: records are buffered up to a size,
+// then sorted by token and clustering and written as one sstable, so sstables may overlap.
+type Builder struct {
+	Dir        string // output directory
+	Generation int    // generation of the next sstable
+	MaxBytes   int64  // values bytes buffered by sstable
+	Timestamp  int64  // rows write time of the first sstable, microseconds, 1 more by next sstable
+	TTL        int64  // rows ttl, seconds, 0 for none
+	Logger     *slog.Logger
+
+	Records  int64 // records added
+	Rows     int64 // rows written, duplicates merged
+	SSTables int   // sstables written
+
+	schema     sstable.Schema
+	partition  []string       // partition key columns names
+	clustering []string       // clustering columns names
+	columns    map[string]int // regular columns index
+	now        int64
+	size       int64
+	partitions map[string]*partition
+}
+
+// partition buffered, with its rows index by clustering
+type partition struct {
+	sstable.Partition
+	rows map[string]int
+}
+
+// New return a builder of sstables of the table, of simple text, int and double columns
+// and at most one clustering column.
+func New(table *cassandra.Table) (*Builder, error) {
+	b := &Builder{
+		Dir:        ".",
+		Generation: 1,
+		MaxBytes:   256 << 20,
+		Timestamp:  time.Now().UnixMicro(),
+		Logger:     slog.Default(),
+		columns:    make(map[string]int),
+		now:        time.Now().Unix(),
+		partitions: make(map[string]*partition),
+	}
+
+	// keys in declaration order, regular columns ordered by name as in sstables
+	columns := slices.Clone(table.Columns)
+	sort.SliceStable(columns, func(i, j int) bool { return columns[i].Position < columns[j].Position })
+	var regular []cassandra.Column
+	var errs []error
+	for _, c := range columns {
+		t, ok := sstable.MarshalType(c.Type, c.Order == "desc")
+		if !ok || !sstable.Supported(sstable.MarshalPrefix+typeName(t)) {
+			errs = append(errs, fmt.Errorf("column %s: type %s not supported", c.Name, c.Type))
+			continue
+		}
+
+		switch c.Kind {
+		case cassandra.KindPartitionKey:
+			b.partition = append(b.partition, c.Name)
+			b.schema.PartitionKey = append(b.schema.PartitionKey, t)
+		case cassandra.KindClustering:
+			b.clustering = append(b.clustering, c.Name)
+			b.schema.Clustering = append(b.schema.Clustering, t)
+		case cassandra.KindRegular:
+			regular = append(regular, c)
+		default:
+			errs = append(errs, fmt.Errorf("column %s: %s columns not supported", c.Name, c.Kind))
+		}
+	}
+	if len(b.clustering) > 1 {
+		errs = append(errs, fmt.Errorf("clustering key: %d columns, only one supported", len(b.clustering)))
+	}
+	if err := errors.Join(errs...); err != nil {
+		return nil, err
+	}
+
+	b.schema.Compound = len(b.partition) > 1
+	slices.SortFunc(regular, func(a, c cassandra.Column) int {
+		return strings.Compare(a.Name, c.Name)
+	})
+	for i, c := range regular {
+		t, _ := sstable.MarshalType(c.Type, false)
+		b.columns[c.Name] = i
+		b.schema.Columns = append(b.schema.Columns, sstable.SchemaEntry{Name: c.Name, Type: t, Size: sstable.GetTypeSize(t)})
+	}
+
+	return b, nil
+}
+
+// Add a record of values by column name, a missing or nil value is null.
+// A record of a row already added overwrites its non null values.
+func (b *Builder) Add(record map[string]any) error {
+	for name := range record {
+		if _, ok := b.columns[name]; !ok && !slices.Contains(b.partition, name) && !slices.Contains(b.clustering, name) {
+			return fmt.Errorf("column %s: not in table", name)
+		}
+	}
+
+	// primary key
+	components := make([][]byte, len(b.partition))
+	for i, name := range b.partition {
+		v, err := b.value(record, name, b.schema.PartitionKey[i])
+		if err != nil {
+			return err
+		}
+		if v == nil || len(v) == 0 && !b.schema.Compound {
+			return fmt.Errorf("partition key %s: null or empty", name)
+		}
+		components[i] = v
+	}
+	var clustering []byte
+	for i, name := range b.clustering {
+		v, err := b.value(record, name, b.schema.Clustering[i])
+		if err != nil {
+			return err
+		}
+		if v == nil {
+			return fmt.Errorf("clustering key %s: null", name)
+		}
+		clustering = v
+	}
+
+	// row liveness and cells share the builder write time and ttl
+	row := sstable.Row{Flags: sstable.HasTimestamp | sstable.HasAllColumns, ClusteringValue: clustering}
+	flags := sstable.UseRowTimestamp
+	if b.TTL > 0 {
+		row.Flags |= sstable.HasTTL
+		flags |= sstable.IsExpiring | sstable.UseRowTTL
+	}
+	row.Cells = make([]sstable.Cell, len(b.schema.Columns))
+	size := int64(len(clustering))
+	for i, c := range b.schema.Columns {
+		v, err := b.value(record, c.Name, c.Type)
+		if err != nil {
+			return err
+		}
+		if v == nil && len(b.schema.Columns) >= 64 {
+			return fmt.Errorf("column %s: null values not supported in tables of 64 columns or more", c.Name)
+		}
+		if v == nil {
+			row.Cells[i] = sstable.Cell{TypeSize: c.Size, Flags: sstable.HasEmptyValue}
+			row.MissingColumns |= 1 << i
+			continue
+		}
+		row.Cells[i] = sstable.Cell{TypeSize: c.Size, Flags: flags, Value: v}
+		size += int64(len(v))
+	}
+	if row.MissingColumns != 0 {
+		row.Flags &^= sstable.HasAllColumns
+	}
+
+	// partition and row of the record
+	key := sstable.JoinKey(components, b.schema.Compound)
+	p, ok := b.partitions[string(key)]
+	if !ok {
+		p = &partition{rows: make(map[string]int)}
+		p.Key = key
+		p.Token = sstable.Token(key)
+		p.HeaderLocalDeletiontime = sstable.LiveLocalDeletionTime
+		p.HeaderMarkedforDeleteAt = sstable.LiveMarkedForDeleteAt
+		for _, c := range components {
+			p.HeaderKeys = append(p.HeaderKeys, sstable.HeaderKey{Value: c})
+		}
+		b.partitions[string(key)] = p
+		size += int64(len(key))
+	}
+	if i, ok := p.rows[string(clustering)]; ok {
+		overwrite(&p.Rows[i], &row)
+	} else {
+		p.rows[string(clustering)] = len(p.Rows)
+		p.Rows = append(p.Rows, row)
+	}
+	b.Records++
+
+	b.size += size
+	if b.size >= b.MaxBytes {
+		return b.Flush()
+	}
+	return nil
+}
+
+// overwrite the cells of row by the non null ones of other.
+func overwrite(row, other *sstable.Row) {
+	for i := range other.Cells {
+		if other.Missing(i) {
+			continue
+		}
+		row.Cells[i] = other.Cells[i]
+		row.MissingColumns &^= 1 << i
+	}
+	if row.MissingColumns == 0 {
+		row.Flags |= sstable.HasAllColumns
+	}
+}
+
+// value return the serialized value of a column of the record, nil if null.
+func (b *Builder) value(record map[string]any, name, t string) ([]byte, error) {
+	v, ok := record[name]
+	if !ok || v == nil {
+		return nil, nil
+	}
+	value, err := Encode(v, typeName(t))
+	if err != nil {
+		return nil, fmt.Errorf("column %s: %w", name, err)
+	}
+	return value, nil
+}
+
+// Flush write the buffered records as an sstable, sorted by token and clustering.
+func (b *Builder) Flush() error {
+	if len(b.partitions) == 0 {
+		return nil
+	}
+
+	prefix := filepath.Join(b.Dir, fmt.Sprintf("mc-%d-big", b.Generation))
+	if _, err := os.Stat(prefix + "-Data.db"); err == nil {
+		return fmt.Errorf("sstable %s: already exists", prefix)
+	}
+
+	// all rows share the write time and expiration, deltas are 0,
+	// later sstables are written later so their records overwrite the previous ones
+	schema := b.schema
+	schema.MinTimestamp = b.Timestamp + int64(b.SSTables)
+	schema.MinLocalDeletionTime = sstable.LocalDeletionTimeEpoch
+	schema.MinTTL = b.TTL
+	if b.TTL > 0 {
+		schema.MinLocalDeletionTime = b.now + b.TTL
+	}
+
+	partitions := make([]*partition, 0, len(b.partitions))
+	for _, p := range b.partitions {
+		partitions = append(partitions, p)
+	}
+	slices.SortFunc(partitions, func(p, q *partition) int {
+		if p.Less(&q.Partition) {
+			return -1
+		}
+		return 1
+	})
+
+	w, err := sstable.NewWriter(prefix, schema)
+	if err != nil {
+		return err
+	}
+	for _, p := range partitions {
+		if len(schema.Clustering) > 0 {
+			t := schema.Clustering[0]
+			slices.SortFunc(p.Rows, func(r, s sstable.Row) int {
+				return sstable.CompareValues(t, r.ClusteringValue, s.ClusteringValue)
+			})
+		}
+		err = w.Write(&p.Partition)
+		if err != nil {
+			return errors.Join(err, w.Abort())
+		}
+	}
+	err = w.Close()
+	if err != nil {
+		return errors.Join(err, w.Abort())
+	}
+	b.Logger.Info("sstable written", "sstable", prefix, "partitions", w.Partitions, "rows", w.Rows)
+
+	b.Rows += w.Rows
+	b.SSTables++
+	b.Generation++
+	b.size = 0
+	b.partitions = make(map[string]*partition)
+
+	return nil
+}
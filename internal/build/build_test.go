@@ -0,0 +1,119 @@
+package build
+
+import (
+	"context"
+	"encoding/binary"
+	"io"
+	"log/slog"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"github.com/gocql/gocql"
+
+	"sstloader/internal/cassandra"
+	"sstloader/pkg/sstable"
+)
+
+// readBuilt return the rows of an sstable written by the builder, by partition key.
+func readBuilt(t *testing.T, prefix string) map[string][][]any {
+	t.Helper()
+
+	sst := sstable.New()
+	sst.Logger = slog.New(slog.NewTextHandler(io.Discard, nil))
+	sst.DataFile = prefix + "-Data.db"
+	sst.StatisticsFile = prefix + "-Statistics.db"
+	sst.CompressionFile = prefix + "-CompressionInfo.db"
+	sst.BatchSize = 100
+	sst.BatchBytes = 1 << 20
+	sst.Sampling = 1
+	err := sst.ReadStatistics()
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = sst.ReadData()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ch := make(chan sstable.Batch, 100)
+	sst.ReadPartitions(context.Background(), ch)
+	close(ch)
+	rows := make(map[string][][]any)
+	for batch := range ch {
+		rows[batch.Key] = append(rows[batch.Key], batch.Rows...)
+	}
+	return rows
+}
+
+func TestBuild(t *testing.T) {
+	unset := any(&gocql.UnsetValue)
+	int32Value := func(i int32) []byte { return binary.BigEndian.AppendUint32(nil, uint32(i)) }
+
+	tests := []struct {
+		name    string
+		ddl     string
+		records []map[string]any
+		rows    map[string][][]any
+	}{
+		{
+			name: "no clustering column",
+			ddl:  "CREATE TABLE ks.t (id text PRIMARY KEY, a text, b int, c double)",
+			records: []map[string]any{
+				{"id": "k1", "a": "x", "b": "1", "c": "1.5"},
+				{"id": "k2", "a": "y"},
+				{"id": "k1", "b": "2"},
+			},
+			rows: map[string][][]any{
+				"k1": {{[]byte("k1"), "x", int32(2), 1.5}},
+				"k2": {{[]byte("k2"), "y", unset, unset}},
+			},
+		},
+		{
+			name: "descending clustering column",
+			ddl:  "CREATE TABLE ks.t (id text, ck int, a text, PRIMARY KEY (id, ck)) WITH CLUSTERING ORDER BY (ck DESC)",
+			records: []map[string]any{
+				{"id": "k1", "ck": "1", "a": "x"},
+				{"id": "k1", "ck": "3", "a": "y"},
+				{"id": "k1", "ck": "2"},
+			},
+			rows: map[string][][]any{
+				"k1": {
+					{[]byte("k1"), int32Value(3), "y"},
+					{[]byte("k1"), int32Value(2), unset},
+					{[]byte("k1"), int32Value(1), "x"},
+				},
+			},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			table, err := cassandra.ParseCreateTable(test.ddl)
+			if err != nil {
+				t.Fatal(err)
+			}
+			b, err := New(table)
+			if err != nil {
+				t.Fatal(err)
+			}
+			b.Dir = t.TempDir()
+			b.Logger = slog.New(slog.NewTextHandler(io.Discard, nil))
+			for _, record := range test.records {
+				err = b.Add(record)
+				if err != nil {
+					t.Fatal(err)
+				}
+			}
+			err = b.Flush()
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			rows := readBuilt(t, filepath.Join(b.Dir, "mc-1-big"))
+			if !reflect.DeepEqual(rows, test.rows) {
+				t.Errorf("rows read %v, want %v", rows, test.rows)
+			}
+		})
+	}
+}
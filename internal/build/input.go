@@ -0,0 +1,133 @@
+package build
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"os"
+	"strconv"
+	"strings"
+
+	"sstloader/pkg/sstable"
+)
+
+// ReadCSV call fn for each record of a csv file, the first line naming the columns.
+// Empty fields are null.
+func ReadCSV(path string, fn func(map[string]any) error) error {
+	file, err := os.Open(path)
+	if err != nil {
+		return fmt.Errorf("open csv-file: %w", err)
+	}
+	defer file.Close()
+
+	r := csv.NewReader(bufio.NewReader(file))
+	header, err := r.Read()
+	if err != nil {
+		return fmt.Errorf("read csv header: %w", err)
+	}
+
+	for {
+		fields, err := r.Read()
+		if errors.Is(err, io.EOF) {
+			return nil
+		}
+		if err != nil {
+			return fmt.Errorf("read csv-file: %w", err)
+		}
+
+		record := make(map[string]any, len(header))
+		for i, name := range header {
+			if fields[i] != "" {
+				record[name] = fields[i]
+			}
+		}
+		err = fn(record)
+		if err != nil {
+			line, _ := r.FieldPos(0)
+			return fmt.Errorf("line %d: %w", line, err)
+		}
+	}
+}
+
+// ReadNDJSON call fn for each record of a file of json objects, one per line.
+func ReadNDJSON(path string, fn func(map[string]any) error) error {
+	file, err := os.Open(path)
+	if err != nil {
+		return fmt.Errorf("open json-file: %w", err)
+	}
+	defer file.Close()
+
+	scanner := bufio.NewScanner(file)
+	scanner.Buffer(make([]byte, 64*1024), 16*1024*1024)
+	line := 0
+	for scanner.Scan() {
+		line++
+		if len(bytes.TrimSpace(scanner.Bytes())) == 0 {
+			continue
+		}
+
+		var record map[string]any
+		decoder := json.NewDecoder(bytes.NewReader(scanner.Bytes()))
+		decoder.UseNumber()
+		err = decoder.Decode(&record)
+		if err == nil {
+			err = fn(record)
+		}
+		if err != nil {
+			return fmt.Errorf("line %d: %w", line, err)
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return fmt.Errorf("read json-file: %w", err)
+	}
+
+	return nil
+}
+
+// Encode serialize a text or json value as a value of a marshal type, as UTF8Type.
+func Encode(v any, t string) ([]byte, error) {
+	var s string
+	switch v := v.(type) {
+	case string:
+		s = v
+	case json.Number:
+		if t == "UTF8Type" {
+			return nil, fmt.Errorf("number %s for text", v)
+		}
+		s = v.String()
+	default:
+		return nil, fmt.Errorf("value %v of type %T not supported", v, v)
+	}
+
+	switch t {
+	case "UTF8Type":
+		return []byte(s), nil
+	case "Int32Type":
+		n, err := strconv.ParseInt(s, 10, 32)
+		if err != nil {
+			return nil, fmt.Errorf("invalid int %q", s)
+		}
+		return binary.BigEndian.AppendUint32(nil, uint32(n)), nil
+	case "DoubleType":
+		f, err := strconv.ParseFloat(s, 64)
+		if err != nil {
+			return nil, fmt.Errorf("invalid double %q", s)
+		}
+		return binary.BigEndian.AppendUint64(nil, math.Float64bits(f)), nil
+	}
+	return nil, fmt.Errorf("type %s not supported", t)
+}
+
+// typeName return the marshal type name without prefix nor reversed order.
+func typeName(t string) string {
+	if strings.HasPrefix(t, sstable.ReversedType+"(") && strings.HasSuffix(t, ")") {
+		t = t[len(sstable.ReversedType)+1 : len(t)-1]
+	}
+	return strings.TrimPrefix(t, sstable.MarshalPrefix)
+}
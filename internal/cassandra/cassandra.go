@@ -1,54 +1,198 @@
 package cassandra
 
 import (
+	"encoding/binary"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
 	"fmt"
+	"io"
+	"log/slog"
+	"maps"
+	"math"
+	"slices"
+	"strconv"
 	"strings"
+	"sync"
 	"sync/atomic"
 	"time"
 
+	"sstloader/internal/metrics"
+	"sstloader/internal/throttle"
 	"sstloader/pkg/sstable"
 
 	"github.com/gocql/gocql"
 )
 
 type CassandraLoader struct {
-	Compress bool
-	Debug    bool
-	Seeds    string
-	KS       string
-	Table    string
-	Timeout  int
-	Retries  int
-	Conns    int
-	DC       string
-	Username string
-	Password string
-	Errors   atomic.Uint64
+	Compress          bool
+	Force             bool
+	Dry               bool
+	Seeds             string
+	Port              int
+	KS                string
+	Table             string
+	Timeout           int
+	Retries           int
+	Conns             int
+	DC                string
+	Username          string
+	Password          string
+	Consistency       string
+	SerialConsistency string
+	SchemaConsistency string
+	Mapping           Mapping
+	Schema            string      // schema file, used instead of system_schema
+	DeadLetter        *DeadLetter // failed rows, if any
+	Metrics           *metrics.Metrics
+	Throttle          *throttle.Adaptive // fed with queries outcome, if any
+	Logger            *slog.Logger
+	TLS               TLS
+	Errors            atomic.Uint64
+	Failures          Failures
 
 	request string
+	keep    []int    // values index to bind, nil for all
+	names   []string // bound columns names
+	types   []string // bound columns cql types, to print keys
+	out     sync.Mutex
 	session *gocql.Session
 }
 
 func New() *CassandraLoader {
-	return &CassandraLoader{}
+	return &CassandraLoader{Logger: slog.Default()}
 }
 
 func (cl *CassandraLoader) Prepare(sst *sstable.SSTable) error {
 	var (
-		partition      string
-		clustering     string
-		cname          string
-		kind           string
-		regularColumns string
-		columnsFill    string
-		pkNumber       int
+		partition   []string
+		clustering  []string
+		regular     []string
+		sstColumns  []string
+		columnsFill []string
 	)
 
+	// offline, only the schema file is used
+	// the session is kept when preparing the next sstable
+	if !cl.Dry && cl.session == nil {
+		err := cl.Connect()
+		if err != nil {
+			return err
+		}
+	}
+
+	// construct insert query
+
+	// get partition and clustering key
+	columns, err := cl.columns()
+	if err != nil {
+		return err
+	}
+	if cl.KS == "" || cl.Table == "" {
+		return errors.New("keyspace and table are required")
+	}
+
+	for _, c := range keys(columns, KindPartitionKey) {
+		partition = append(partition, c.Name)
+		columnsFill = append(columnsFill, "?")
+	}
+	for _, c := range keys(columns, KindClustering) {
+		clustering = append(clustering, c.Name)
+		columnsFill = append(columnsFill, "?")
+	}
+
+	// check columns mapping (sst side against table side)
+	for _, c := range sst.Schema.Columns {
+		sstColumns = append(sstColumns, c.Name)
+	}
+	err = cl.Mapping.Validate(sstColumns, columns)
+	if err != nil {
+		return fmt.Errorf("invalid columns mapping: %w", err)
+	}
+
+	// check sstable header against table definition
+	err = validateSchema(&sst.Schema, columns, &cl.Mapping)
+	if err != nil {
+		if !cl.Force {
+			return fmt.Errorf("incompatible schema (use --force to load anyway):\n%w", err)
+		}
+		cl.Logger.Warn("incompatible schema", "error", err)
+	}
+
+	// get columns from schemas (sst side), skipping dropped ones
+	keys := len(partition) + len(clustering)
+	cl.names = slices.Concat(partition, clustering)
+	types := make(map[string]string, len(columns))
+	for _, c := range columns {
+		types[c.Name] = c.Type
+	}
+	cl.types = nil
+	for _, name := range cl.names {
+		cl.types = append(cl.types, types[name])
+	}
+	cl.keep = nil
+	if len(cl.Mapping.Drop) > 0 {
+		for i := 0; i < keys; i++ {
+			cl.keep = append(cl.keep, i)
+		}
+	}
+	for i, c := range sstColumns {
+		if cl.Mapping.Dropped(c) {
+			continue
+		}
+		if cl.keep != nil {
+			cl.keep = append(cl.keep, keys+i)
+		}
+		regular = append(regular, cl.Mapping.Column(c))
+		cl.names = append(cl.names, cl.Mapping.Column(c))
+		cl.types = append(cl.types, types[cl.Mapping.Column(c)])
+		columnsFill = append(columnsFill, "?")
+	}
+
+	// constant values for new columns
+	for _, c := range slices.Sorted(maps.Keys(cl.Mapping.Set)) {
+		regular = append(regular, c)
+		columnsFill = append(columnsFill, cl.Mapping.Set[c])
+	}
+
+	// insert reqyest
+	cl.request = "INSERT INTO " + cl.KS + "." + cl.Table +
+		" (" + strings.Join(slices.Concat(partition, clustering, regular), ",") +
+		") VALUES (" + strings.Join(columnsFill, ",") + ")"
+	cl.Logger.Debug("insert query", "query", cl.request)
+
+	return nil
+}
+
+func (cl *CassandraLoader) Connect() error {
+	if cl.Seeds == "" {
+		return errors.New("no seeds, use --seeds or a cqlshrc")
+	}
+
+	consistency, err := gocql.ParseConsistencyWrapper(cl.Consistency)
+	if err != nil {
+		return fmt.Errorf("consistency: %w", err)
+	}
+	serial, err := gocql.ParseConsistencyWrapper(cl.SerialConsistency)
+	if err != nil || (serial != gocql.Serial && serial != gocql.LocalSerial) {
+		return fmt.Errorf("serial consistency: invalid consistency %q", cl.SerialConsistency)
+	}
+
+	hosts, err := Hosts(cl.Seeds, cl.Port)
+	if len(hosts) == 0 {
+		return fmt.Errorf("seeds: %w", err)
+	}
+	if err != nil {
+		cl.Logger.Warn("seeds", "error", err)
+	}
+	cl.Logger.Debug("seeds", "hosts", strings.Join(hosts, ","))
+
 	// cassandra init
-	cluster := gocql.NewCluster(cl.Seeds)
+	cluster := gocql.NewCluster(hosts...)
 	cluster.Keyspace = cl.KS
-	cluster.Consistency = gocql.Any // we don't want to wait
-	cluster.ProtoVersion = 4        // null handling
+	cluster.Consistency = consistency
+	cluster.SerialConsistency = serial
+	cluster.ProtoVersion = 4 // null handling
 	cluster.Timeout = time.Duration(cl.Timeout) * time.Millisecond
 	cluster.WriteTimeout = time.Duration(cl.Timeout) * time.Millisecond
 	cluster.NumConns = cl.Conns // theoricitally handled by the scylla driver
@@ -67,6 +211,20 @@ func (cl *CassandraLoader) Prepare(sst *sstable.SSTable) error {
 		Password: cl.Password,
 	}
 
+	if cl.TLS.Enabled {
+		config, err := cl.TLS.Config()
+		if err != nil {
+			return fmt.Errorf("tls: %w", err)
+		}
+		if config.InsecureSkipVerify && config.VerifyConnection == nil {
+			cl.Logger.Warn("tls without ca nor host verification, the server certificate is not checked")
+		}
+		cluster.SslOpts = &gocql.SslOptions{
+			Config:                 config,
+			EnableHostVerification: cl.TLS.VerifyHost,
+		}
+	}
+
 	session, err := cluster.CreateSession()
 	if err != nil {
 		return fmt.Errorf("create session: %w", err)
@@ -75,54 +233,184 @@ func (cl *CassandraLoader) Prepare(sst *sstable.SSTable) error {
 	// session is goroutine safe
 	cl.session = session
 
-	// construct insert query
-
-	// get partition and clustering key
-	// TODO only text supported
-	req := "SELECT column_name, kind FROM system_schema.columns where keyspace_name = '%s' and table_name = '%s'"
-	iter := cl.session.Query(fmt.Sprintf(req, cl.KS, cl.Table)).Consistency(gocql.LocalQuorum).Iter()
+	return nil
+}
 
-	for iter.Scan(&cname, &kind) {
-		if kind == "partition_key" {
-			partition = partition + cname + ","
-			columnsFill = columnsFill + "?,"
-			pkNumber++
-		} else if kind == "clustering" {
-			clustering = clustering + cname + ","
-			columnsFill = columnsFill + "?,"
+// bind return the values of mapped columns.
+func (cl *CassandraLoader) bind(v []any) []any {
+	// drop values of unmapped columns
+	if cl.keep != nil {
+		kept := make([]any, len(cl.keep))
+		for i, k := range cl.keep {
+			kept[i] = v[k]
 		}
+		v = kept
 	}
+	return v
+}
+
+// Load insert the rows of a batch, the error is returned once accounted.
+func (cl *CassandraLoader) Load(b sstable.Batch) error {
+	var err error
 
-	// FIXME find better to pass it to partitionReader
-	if pkNumber > 1 {
-		sst.Compound = true
+	// nothing to insert, only acknowledged
+	if len(b.Rows) == 0 {
+		return nil
 	}
 
-	// get columns from schemas (sst side)
-	for i := 0; i < len(sstable.Schema); i++ {
-		regularColumns = regularColumns + sstable.Schema[i].Name + ","
-		columnsFill = columnsFill + "?,"
+	rows := make([][]any, len(b.Rows))
+	for i, v := range b.Rows {
+		rows[i] = cl.bind(v)
 	}
 
-	regularColumns = strings.Trim(regularColumns, ",")
-	columnsFill = strings.Trim(columnsFill, ",")
+	if cl.Metrics != nil {
+		cl.Metrics.InFlight.WithLabelValues(b.Source).Inc()
+		defer cl.Metrics.InFlight.WithLabelValues(b.Source).Dec()
+	}
+	start := time.Now()
 
-	// insert reqyest
-	cl.request = "INSERT INTO " + cl.KS + "." + cl.Table +
-		" (" + partition + clustering + regularColumns + ") VALUES (" + columnsFill + ")"
-	if cl.Debug {
-		fmt.Printf("(debug) query: %s \n", cl.request)
+	// rows of a same partition are sent together to their replicas
+	if len(rows) == 1 {
+		err = cl.session.Query(cl.request).Bind(rows[0]...).Exec()
+	} else {
+		batch := cl.session.NewBatch(gocql.UnloggedBatch)
+		for _, v := range rows {
+			batch.Query(cl.request, v...)
+		}
+		err = cl.session.ExecuteBatch(batch)
 	}
 
-	return nil
+	class := ""
+	if err != nil {
+		class = ErrorClass(err)
+	}
+	latency := time.Since(start)
+	if cl.Metrics != nil {
+		cl.Metrics.Observe(b.Source, len(rows), class, latency)
+	}
+	if cl.Throttle != nil {
+		cl.Throttle.Observe(latency, err != nil && Backpressure(err))
+	}
+
+	if err != nil {
+		cl.Errors.Add(uint64(len(rows)))
+		cl.Failures.Add(class, uint64(len(rows)))
+		cl.Logger.Debug("query error", "sstable", b.Source, "key", b.Key, "offset", b.Offset, "rows", len(rows), "class", class, "error", err)
+
+		if cl.DeadLetter != nil {
+			for _, v := range rows {
+				cl.deadLetter(&Record{
+					Query:  cl.request,
+					Values: EncodeValues(v),
+					Error:  err.Error(),
+					Class:  class,
+					Key:    b.Key,
+					Source: b.Source,
+					Offset: b.Offset,
+				})
+			}
+		}
+	}
+
+	return err
 }
 
-func (cl *CassandraLoader) Load(v []any) {
-	err := cl.session.Query(cl.request).Bind(v...).Exec()
+// Replay execute again the query of a dead-letter record.
+func (cl *CassandraLoader) Replay(r *Record) {
+	values, err := DecodeValues(r.Values)
+	switch {
+	case err != nil:
+	case cl.session == nil:
+		err = gocql.ErrNoConnections
+	default:
+		err = cl.session.Query(r.Query).Bind(values...).Exec()
+	}
+
 	if err != nil {
+		r.Error = err.Error()
+		r.Class = ErrorClass(err)
 		cl.Errors.Add(1)
-		if cl.Debug {
-			fmt.Printf("(debug) query error: %v\n", err)
+		cl.Failures.Add(r.Class, 1)
+		cl.Logger.Debug("query error", "sstable", r.Source, "key", r.Key, "offset", r.Offset, "class", r.Class, "error", err)
+
+		if cl.DeadLetter != nil {
+			cl.deadLetter(r)
 		}
 	}
 }
+
+func (cl *CassandraLoader) deadLetter(r *Record) {
+	err := cl.DeadLetter.Write(r)
+	if err != nil {
+		cl.Logger.Error("dead-letter", "error", err)
+	}
+}
+
+// Print write a row as a json object of named and typed values.
+func (cl *CassandraLoader) Print(w io.Writer, v []any) error {
+	values := cl.bind(v)
+	if len(values) != len(cl.names) {
+		return fmt.Errorf("row of %d values for %d columns", len(values), len(cl.names))
+	}
+
+	var b strings.Builder
+
+	b.WriteByte('{')
+	for i, value := range values {
+		if value == any(&gocql.UnsetValue) {
+			continue // unset, no value
+		}
+
+		// keys are serialized values
+		if raw, ok := value.([]byte); ok {
+			value = decodeKey(raw, cl.types[i])
+		}
+
+		var s any
+		switch value := value.(type) {
+		case float64:
+			if math.IsNaN(value) || math.IsInf(value, 0) {
+				s = strconv.FormatFloat(value, 'g', -1, 64)
+			} else {
+				s = value
+			}
+		default:
+			s = value
+		}
+
+		name, _ := json.Marshal(cl.names[i])
+		data, err := json.Marshal(s)
+		if err != nil {
+			return fmt.Errorf("encode column %s: %w", cl.names[i], err)
+		}
+		if b.Len() > 1 {
+			b.WriteByte(',')
+		}
+		b.Write(name)
+		b.WriteByte(':')
+		b.Write(data)
+	}
+	b.WriteString("}\n")
+
+	cl.out.Lock()
+	defer cl.out.Unlock()
+	_, err := io.WriteString(w, b.String())
+	return err
+}
+
+// decodeKey return a serialized key value of a cql type as printed, unknown types in hex.
+func decodeKey(b []byte, t string) any {
+	switch {
+	case t == "text" || t == "varchar" || t == "ascii":
+		return string(b)
+	case t == "int" && len(b) == 4:
+		return int32(binary.BigEndian.Uint32(b))
+	case (t == "bigint" || t == "timestamp") && len(b) == 8:
+		return int64(binary.BigEndian.Uint64(b))
+	case t == "double" && len(b) == 8:
+		return math.Float64frombits(binary.BigEndian.Uint64(b))
+	case (t == "uuid" || t == "timeuuid") && len(b) == 16:
+		return gocql.UUID(b).String()
+	}
+	return "0x" + hex.EncodeToString(b)
+}
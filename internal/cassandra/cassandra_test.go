@@ -0,0 +1,88 @@
+package cassandra
+
+import (
+	"bytes"
+	"encoding/binary"
+	"io"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/gocql/gocql"
+
+	"sstloader/pkg/sstable"
+)
+
+func TestPrint(t *testing.T) {
+	text := sstable.MarshalPrefix + "UTF8Type"
+	int32Type := sstable.MarshalPrefix + "Int32Type"
+	uuid, _ := gocql.ParseUUID("4327529f-b645-dd00-b883-ec39ae448bb8")
+
+	tests := []struct {
+		name   string
+		ddl    string
+		schema sstable.Schema
+		values []any
+		want   string
+	}{
+		{
+			name: "no clustering column",
+			ddl:  "CREATE TABLE ks.t1 (id text PRIMARY KEY, a text, b int)",
+			schema: sstable.Schema{PartitionKey: []string{text}, Columns: []sstable.SchemaEntry{
+				{Name: "a", Type: text}, {Name: "b", Type: int32Type},
+			}},
+			values: []any{[]byte("k"), "x", &gocql.UnsetValue},
+			want:   `{"id":"k","a":"x"}`,
+		},
+		{
+			name: "typed keys",
+			ddl:  "CREATE TABLE ks.t2 (id int, u uuid, ck blob, v double, PRIMARY KEY ((id, u), ck))",
+			schema: sstable.Schema{
+				Compound:     true,
+				PartitionKey: []string{int32Type, sstable.MarshalPrefix + "UUIDType"},
+				Clustering:   []string{sstable.MarshalPrefix + "BytesType"},
+				Columns:      []sstable.SchemaEntry{{Name: "v", Type: sstable.MarshalPrefix + "DoubleType"}},
+			},
+			values: []any{binary.BigEndian.AppendUint32(nil, 42), uuid.Bytes(), []byte{0xca, 0xfe}, 1.5},
+			want:   `{"id":42,"u":"4327529f-b645-dd00-b883-ec39ae448bb8","ck":"0xcafe","v":1.5}`,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			schema := filepath.Join(t.TempDir(), "schema.cql")
+			err := os.WriteFile(schema, []byte(test.ddl), 0600)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			cl := New()
+			cl.Logger = slog.New(slog.NewTextHandler(io.Discard, nil))
+			cl.Dry = true
+			cl.Force = true
+			cl.Schema = schema
+			sst := sstable.New()
+			sst.Schema = test.schema
+			err = cl.Prepare(sst)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			var out bytes.Buffer
+			err = cl.Print(&out, test.values)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if out.String() != test.want+"\n" {
+				t.Errorf("printed %s, want %s", out.String(), test.want)
+			}
+
+			// a row not matching the columns is an error
+			err = cl.Print(&out, test.values[1:])
+			if err == nil {
+				t.Error("row of missing values printed")
+			}
+		})
+	}
+}
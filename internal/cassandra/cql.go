@@ -0,0 +1,428 @@
+package cassandra
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+	"unicode"
+)
+
+type Table struct {
+	Keyspace string
+	Name     string
+	Columns  []Column
+}
+
+// ReadSchemaFile parse the first CREATE TABLE statement of a cql file (as a snapshot schema.cql).
+func ReadSchemaFile(path string) (*Table, error) {
+	ddl, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("open schema-file: %w", err)
+	}
+
+	table, err := ParseCreateTable(string(ddl))
+	if err != nil {
+		return nil, fmt.Errorf("parse schema-file: %w", err)
+	}
+
+	return table, nil
+}
+
+// ParseCreateTable parse a CREATE TABLE statement into the table columns,
+// with the same kinds, positions, types and clustering order than system_schema.columns.
+// Other statements before it are skipped.
+func ParseCreateTable(ddl string) (*Table, error) {
+	tokens, err := tokenize(ddl)
+	if err != nil {
+		return nil, err
+	}
+
+	p := &parser{tokens: tokens}
+	for !p.eof() {
+		if p.keyword("create") && p.peekKeyword("table") {
+			p.next()
+			return p.createTable()
+		}
+		// skip to next statement
+		for !p.eof() && !p.symbol(";") {
+			p.next()
+		}
+	}
+
+	return nil, errors.New("no CREATE TABLE statement")
+}
+
+type parser struct {
+	tokens []token
+	pos    int
+}
+
+type token struct {
+	value  string
+	quoted bool // quoted identifier or string literal
+}
+
+func (p *parser) eof() bool {
+	return p.pos >= len(p.tokens)
+}
+
+func (p *parser) peek() string {
+	if p.eof() {
+		return ""
+	}
+	return p.tokens[p.pos].value
+}
+
+func (p *parser) next() string {
+	v := p.peek()
+	p.pos++
+	return v
+}
+
+// keyword consume the next token if it is the (unquoted) keyword.
+func (p *parser) keyword(kw string) bool {
+	if p.eof() || p.tokens[p.pos].quoted || !strings.EqualFold(p.tokens[p.pos].value, kw) {
+		return false
+	}
+	p.pos++
+	return true
+}
+
+func (p *parser) peekKeyword(kw string) bool {
+	return !p.eof() && !p.tokens[p.pos].quoted && strings.EqualFold(p.tokens[p.pos].value, kw)
+}
+
+// symbol consume the next token if it is the (unquoted) symbol.
+func (p *parser) symbol(s string) bool {
+	if !p.peekSymbol(s) {
+		return false
+	}
+	p.pos++
+	return true
+}
+
+func (p *parser) peekSymbol(s string) bool {
+	return !p.eof() && !p.tokens[p.pos].quoted && p.tokens[p.pos].value == s
+}
+
+func (p *parser) expect(s string) error {
+	if v := p.next(); v != s {
+		return fmt.Errorf("expected %q, got %q", s, v)
+	}
+	return nil
+}
+
+// identifier are case insensitive unless quoted.
+func (p *parser) identifier() (string, error) {
+	if p.eof() {
+		return "", errors.New("unexpected end of statement")
+	}
+	t := p.tokens[p.pos]
+	p.pos++
+	if t.quoted {
+		return t.value, nil
+	}
+	if !isIdentifier(t.value) {
+		return "", fmt.Errorf("expected identifier, got %q", t.value)
+	}
+	return strings.ToLower(t.value), nil
+}
+
+func (p *parser) createTable() (*Table, error) {
+	table := &Table{}
+
+	if p.keyword("if") {
+		if !p.keyword("not") || !p.keyword("exists") {
+			return nil, errors.New("expected IF NOT EXISTS")
+		}
+	}
+
+	name, err := p.identifier()
+	if err != nil {
+		return nil, err
+	}
+	if p.peek() == "." {
+		p.next()
+		table.Keyspace = name
+		name, err = p.identifier()
+		if err != nil {
+			return nil, err
+		}
+	}
+	table.Name = name
+
+	if err := p.expect("("); err != nil {
+		return nil, err
+	}
+
+	var (
+		partition  []string
+		clustering []string
+	)
+
+	// columns definitions and primary key
+	for {
+		if p.keyword("primary") {
+			if !p.keyword("key") {
+				return nil, errors.New("expected PRIMARY KEY")
+			}
+			partition, clustering, err = p.primaryKey()
+			if err != nil {
+				return nil, err
+			}
+		} else {
+			c := Column{Kind: KindRegular, Position: -1}
+			c.Name, err = p.identifier()
+			if err != nil {
+				return nil, err
+			}
+			c.Type, err = p.cqlType()
+			if err != nil {
+				return nil, fmt.Errorf("column %s: %w", c.Name, err)
+			}
+			if p.keyword("static") {
+				c.Kind = KindStatic
+			}
+			if p.keyword("primary") {
+				if !p.keyword("key") {
+					return nil, errors.New("expected PRIMARY KEY")
+				}
+				partition = []string{c.Name}
+			}
+			table.Columns = append(table.Columns, c)
+		}
+
+		sep := p.next()
+		if sep == ")" {
+			break
+		}
+		if sep != "," {
+			return nil, fmt.Errorf("expected \",\" or \")\", got %q", sep)
+		}
+	}
+
+	if len(partition) == 0 {
+		return nil, errors.New("no primary key")
+	}
+
+	// clustering order from table options
+	order := make(map[string]string)
+	for !p.eof() && !p.peekSymbol(";") {
+		if p.keyword("clustering") {
+			if !p.keyword("order") || !p.keyword("by") {
+				return nil, errors.New("expected CLUSTERING ORDER BY")
+			}
+			if err := p.expect("("); err != nil {
+				return nil, err
+			}
+			for {
+				c, err := p.identifier()
+				if err != nil {
+					return nil, err
+				}
+				order[c] = strings.ToLower(p.next())
+				if p.peek() != "," {
+					break
+				}
+				p.next()
+			}
+			if err := p.expect(")"); err != nil {
+				return nil, err
+			}
+			continue
+		}
+		p.next()
+	}
+
+	// set key kinds and positions
+	set := func(names []string, kind string) error {
+		for i, name := range names {
+			found := false
+			for j := range table.Columns {
+				if table.Columns[j].Name == name {
+					table.Columns[j].Kind = kind
+					table.Columns[j].Position = i
+					found = true
+				}
+			}
+			if !found {
+				return fmt.Errorf("primary key column %s not defined", name)
+			}
+		}
+		return nil
+	}
+	if err := set(partition, KindPartitionKey); err != nil {
+		return nil, err
+	}
+	if err := set(clustering, KindClustering); err != nil {
+		return nil, err
+	}
+
+	for i := range table.Columns {
+		c := &table.Columns[i]
+		switch c.Kind {
+		case KindClustering:
+			c.Order = "asc"
+			if o, ok := order[c.Name]; ok {
+				c.Order = o
+			}
+		default:
+			c.Order = "none"
+		}
+	}
+
+	return table, nil
+}
+
+// primaryKey parse PRIMARY KEY ((pk1, pk2), ck1, ck2) or PRIMARY KEY (pk, ck1).
+func (p *parser) primaryKey() ([]string, []string, error) {
+	var (
+		partition  []string
+		clustering []string
+	)
+
+	if err := p.expect("("); err != nil {
+		return nil, nil, err
+	}
+
+	if p.peek() == "(" {
+		p.next()
+		for {
+			c, err := p.identifier()
+			if err != nil {
+				return nil, nil, err
+			}
+			partition = append(partition, c)
+			if p.peek() != "," {
+				break
+			}
+			p.next()
+		}
+		if err := p.expect(")"); err != nil {
+			return nil, nil, err
+		}
+	} else {
+		c, err := p.identifier()
+		if err != nil {
+			return nil, nil, err
+		}
+		partition = append(partition, c)
+	}
+
+	for p.peek() == "," {
+		p.next()
+		c, err := p.identifier()
+		if err != nil {
+			return nil, nil, err
+		}
+		clustering = append(clustering, c)
+	}
+
+	if err := p.expect(")"); err != nil {
+		return nil, nil, err
+	}
+
+	return partition, clustering, nil
+}
+
+// cqlType parse a type as written by system_schema (lowercase, "map<text, int>").
+func (p *parser) cqlType() (string, error) {
+	name, err := p.identifier()
+	if err != nil {
+		return "", err
+	}
+	if name == "varchar" {
+		name = "text"
+	}
+
+	if p.peek() != "<" {
+		return name, nil
+	}
+	p.next()
+
+	var params []string
+	for {
+		t, err := p.cqlType()
+		if err != nil {
+			return "", err
+		}
+		params = append(params, t)
+		if p.peek() != "," {
+			break
+		}
+		p.next()
+	}
+	if err := p.expect(">"); err != nil {
+		return "", err
+	}
+
+	return name + "<" + strings.Join(params, ", ") + ">", nil
+}
+
+func isIdentifier(s string) bool {
+	for i, c := range s {
+		if !(unicode.IsLetter(c) || c == '_' || (i > 0 && unicode.IsDigit(c))) {
+			return false
+		}
+	}
+	return s != ""
+}
+
+// tokenize split cql into identifiers, literals and symbols, dropping comments.
+func tokenize(s string) ([]token, error) {
+	var tokens []token
+
+	for i := 0; i < len(s); {
+		c := s[i]
+		switch {
+		case c == ' ' || c == '\t' || c == '\n' || c == '\r':
+			i++
+		case strings.HasPrefix(s[i:], "--") || strings.HasPrefix(s[i:], "//"):
+			end := strings.IndexByte(s[i:], '\n')
+			if end < 0 {
+				return tokens, nil
+			}
+			i += end + 1
+		case strings.HasPrefix(s[i:], "/*"):
+			end := strings.Index(s[i+2:], "*/")
+			if end < 0 {
+				return nil, errors.New("unterminated comment")
+			}
+			i += end + 4
+		case c == '"' || c == '\'':
+			// quoted identifier or string, doubled quote is escaped
+			var b strings.Builder
+			j := i + 1
+			for {
+				if j >= len(s) {
+					return nil, errors.New("unterminated quoted string")
+				}
+				if s[j] == c {
+					if j+1 < len(s) && s[j+1] == c {
+						b.WriteByte(c)
+						j += 2
+						continue
+					}
+					break
+				}
+				b.WriteByte(s[j])
+				j++
+			}
+			tokens = append(tokens, token{value: b.String(), quoted: true})
+			i = j + 1
+		case strings.IndexByte("(),<>;.=", c) >= 0:
+			tokens = append(tokens, token{value: string(c)})
+			i++
+		default:
+			j := i
+			for j < len(s) && strings.IndexByte(" \t\r\n(),<>;.='\"", s[j]) < 0 {
+				j++
+			}
+			tokens = append(tokens, token{value: s[i:j]})
+			i = j
+		}
+	}
+
+	return tokens, nil
+}
@@ -0,0 +1,112 @@
+package cassandra
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestParseCreateTable(t *testing.T) {
+	tests := []struct {
+		name  string
+		ddl   string
+		table Table
+	}{
+		{
+			name: "inline primary key",
+			ddl:  "CREATE TABLE ks.t (id text PRIMARY KEY, v int);",
+			table: Table{Keyspace: "ks", Name: "t", Columns: []Column{
+				{Name: "id", Kind: KindPartitionKey, Position: 0, Type: "text", Order: "none"},
+				{Name: "v", Kind: KindRegular, Position: -1, Type: "int", Order: "none"},
+			}},
+		},
+		{
+			name: "composite keys and clustering order",
+			ddl: `CREATE TABLE IF NOT EXISTS ks.events (
+				a text, b int, c timestamp, d double, e varchar,
+				PRIMARY KEY ((a, b), c, d)
+			) WITH CLUSTERING ORDER BY (c DESC, d ASC)
+				AND gc_grace_seconds = 864000;`,
+			table: Table{Keyspace: "ks", Name: "events", Columns: []Column{
+				{Name: "a", Kind: KindPartitionKey, Position: 0, Type: "text", Order: "none"},
+				{Name: "b", Kind: KindPartitionKey, Position: 1, Type: "int", Order: "none"},
+				{Name: "c", Kind: KindClustering, Position: 0, Type: "timestamp", Order: "desc"},
+				{Name: "d", Kind: KindClustering, Position: 1, Type: "double", Order: "asc"},
+				{Name: "e", Kind: KindRegular, Position: -1, Type: "text", Order: "none"},
+			}},
+		},
+		{
+			name: "quoted identifiers",
+			ddl:  `CREATE TABLE "Ks"."MyTable" ("Id" text, "say ""hi""" int, Plain text, PRIMARY KEY ("Id", Plain)) WITH CLUSTERING ORDER BY (plain DESC)`,
+			table: Table{Keyspace: "Ks", Name: "MyTable", Columns: []Column{
+				{Name: "Id", Kind: KindPartitionKey, Position: 0, Type: "text", Order: "none"},
+				{Name: `say "hi"`, Kind: KindRegular, Position: -1, Type: "int", Order: "none"},
+				{Name: "plain", Kind: KindClustering, Position: 0, Type: "text", Order: "desc"},
+			}},
+		},
+		{
+			name: "nested collections and static column",
+			ddl: `CREATE TABLE t (id uuid, ck int, s text static, m MAP<varchar, frozen<list<int>>>, tags set<varchar>,
+				PRIMARY KEY (id, ck))`,
+			table: Table{Name: "t", Columns: []Column{
+				{Name: "id", Kind: KindPartitionKey, Position: 0, Type: "uuid", Order: "none"},
+				{Name: "ck", Kind: KindClustering, Position: 0, Type: "int", Order: "asc"},
+				{Name: "s", Kind: KindStatic, Position: -1, Type: "text", Order: "none"},
+				{Name: "m", Kind: KindRegular, Position: -1, Type: "map<text, frozen<list<int>>>", Order: "none"},
+				{Name: "tags", Kind: KindRegular, Position: -1, Type: "set<text>", Order: "none"},
+			}},
+		},
+		{
+			name: "comments and other statements",
+			ddl: `-- snapshot schema; not a statement
+				CREATE KEYSPACE ks WITH replication = {'class': 'SimpleStrategy', 'replication_factor': '1'};
+				/* CREATE TABLE ks.old (id text PRIMARY KEY); */
+				INSERT INTO ks.other (id) VALUES (';'); // a quoted ; does not end the statement
+				CREATE TABLE ks.t ( // table
+					id text, -- partition key
+					ck text, /* clustering key */
+					PRIMARY KEY (id, ck)
+				) WITH comment = ';' AND CLUSTERING ORDER BY (ck DESC);`,
+			table: Table{Keyspace: "ks", Name: "t", Columns: []Column{
+				{Name: "id", Kind: KindPartitionKey, Position: 0, Type: "text", Order: "none"},
+				{Name: "ck", Kind: KindClustering, Position: 0, Type: "text", Order: "desc"},
+			}},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			table, err := ParseCreateTable(test.ddl)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(*table, test.table) {
+				t.Errorf("got %+v\nwant %+v", *table, test.table)
+			}
+		})
+	}
+}
+
+func TestParseCreateTableErrors(t *testing.T) {
+	tests := []struct {
+		name string
+		ddl  string
+	}{
+		{"no create table", "CREATE KEYSPACE ks WITH replication = {'class': 'SimpleStrategy'};"},
+		{"create table in a string", "INSERT INTO ks.t (id) VALUES ('CREATE TABLE t (id text PRIMARY KEY)');"},
+		{"no primary key", "CREATE TABLE t (id text, v int);"},
+		{"undefined key column", "CREATE TABLE t (id text, PRIMARY KEY (id, ck));"},
+		{"missing separator", "CREATE TABLE t (id text PRIMARY KEY v int);"},
+		{"unterminated type", "CREATE TABLE t (id text PRIMARY KEY, m map<text, int);"},
+		{"unterminated string", "CREATE TABLE t (id text PRIMARY KEY) WITH comment = 'x;"},
+		{"unterminated comment", "CREATE TABLE t (id text PRIMARY KEY) /* x;"},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			table, err := ParseCreateTable(test.ddl)
+			if err == nil {
+				t.Errorf("no error, got %+v", *table)
+			}
+		})
+	}
+}
@@ -0,0 +1,128 @@
+package cassandra
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// DefaultCqlshrc return the cqlsh configuration file of the user.
+func DefaultCqlshrc() string {
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return ""
+	}
+	return filepath.Join(home, ".cassandra", "cqlshrc")
+}
+
+// ReadCqlshrc fill the credentials and connection settings not already set
+// from the [authentication], [connection] and [ssl] sections of a cqlshrc file.
+// A missing file is ignored unless required.
+func (cl *CassandraLoader) ReadCqlshrc(path string, required bool) error {
+	ini, err := readIni(path)
+	if errors.Is(err, fs.ErrNotExist) && !required {
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("read cqlshrc: %w", err)
+	}
+
+	set := func(field *string, section, key string) {
+		if v, ok := ini[section][key]; ok && *field == "" {
+			*field = v
+		}
+	}
+	enabled := func(section, key string, def bool) bool {
+		v, ok := ini[section][key]
+		if !ok {
+			return def
+		}
+		b, err := strconv.ParseBool(v)
+		if err != nil {
+			return def
+		}
+		return b
+	}
+
+	set(&cl.Username, "authentication", "username")
+	set(&cl.Password, "authentication", "password")
+
+	set(&cl.Seeds, "connection", "hostname")
+	if port, err := strconv.Atoi(ini["connection"]["port"]); err == nil && cl.Port == 0 {
+		cl.Port = port
+	}
+
+	if enabled("connection", "ssl", false) {
+		cl.TLS.Enabled = true
+	}
+	if enabled("ssl", "validate", true) {
+		set(&cl.TLS.CA, "ssl", "certfile")
+		if enabled("ssl", "check_hostname", false) {
+			cl.TLS.VerifyHost = true
+		}
+	}
+	set(&cl.TLS.Cert, "ssl", "usercert")
+	set(&cl.TLS.Key, "ssl", "userkey")
+
+	return nil
+}
+
+// ReadPasswordFile set the password, if not already set, from the first line of a file.
+func (cl *CassandraLoader) ReadPasswordFile(path string) error {
+	if cl.Password != "" {
+		return nil
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return fmt.Errorf("read password file: %w", err)
+	}
+	cl.Password, _, _ = strings.Cut(string(data), "\n")
+	cl.Password = strings.TrimSuffix(cl.Password, "\r")
+
+	return nil
+}
+
+// readIni parse an ini file into sections of key values.
+func readIni(path string) (map[string]map[string]string, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	ini := make(map[string]map[string]string)
+	section := ""
+
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || line[0] == '#' || line[0] == ';' {
+			continue
+		}
+
+		if line[0] == '[' && line[len(line)-1] == ']' {
+			section = strings.ToLower(strings.TrimSpace(line[1 : len(line)-1]))
+			continue
+		}
+
+		key, value, ok := strings.Cut(line, "=")
+		if !ok {
+			key, value, ok = strings.Cut(line, ":")
+		}
+		if !ok {
+			continue
+		}
+		if ini[section] == nil {
+			ini[section] = make(map[string]string)
+		}
+		ini[section][strings.ToLower(strings.TrimSpace(key))] = strings.TrimSpace(value)
+	}
+
+	return ini, scanner.Err()
+}
@@ -0,0 +1,159 @@
+package cassandra
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"sync"
+
+	"github.com/gocql/gocql"
+)
+
+// Record is a failed row of the dead-letter file, enough to replay it.
+type Record struct {
+	Query  string  `json:"query"`
+	Values []Value `json:"values"`
+	Error  string  `json:"error"`
+	Class  string  `json:"class"`
+	Key    string  `json:"key"`
+	Source string  `json:"source"`
+	Offset int64   `json:"offset"` // partition offset in uncompressed data
+}
+
+// Value is a typed bound value.
+type Value struct {
+	Type  string          `json:"type"` // text, blob, int, double or unset
+	Value json.RawMessage `json:"value,omitempty"`
+}
+
+// DeadLetter write failed rows as json lines.
+type DeadLetter struct {
+	mu   sync.Mutex
+	file *os.File
+	w    *bufio.Writer
+}
+
+func OpenDeadLetter(path string) (*DeadLetter, error) {
+	file, err := os.OpenFile(path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0o600)
+	if err != nil {
+		return nil, fmt.Errorf("open dead-letter file: %w", err)
+	}
+
+	return &DeadLetter{file: file, w: bufio.NewWriter(file)}, nil
+}
+
+func (dl *DeadLetter) Write(r *Record) error {
+	data, err := json.Marshal(r)
+	if err != nil {
+		return fmt.Errorf("encode dead-letter: %w", err)
+	}
+
+	dl.mu.Lock()
+	defer dl.mu.Unlock()
+	_, err = dl.w.Write(append(data, '\n'))
+	return err
+}
+
+// Flush write buffered records to the file.
+func (dl *DeadLetter) Flush() error {
+	dl.mu.Lock()
+	defer dl.mu.Unlock()
+	return dl.w.Flush()
+}
+
+func (dl *DeadLetter) Close() error {
+	return errors.Join(dl.Flush(), dl.file.Close())
+}
+
+// ReadDeadLetters call fn for each record of a dead-letter file.
+func ReadDeadLetters(path string, fn func(*Record) error) error {
+	file, err := os.Open(path)
+	if err != nil {
+		return fmt.Errorf("open dead-letter file: %w", err)
+	}
+	defer file.Close()
+
+	decoder := json.NewDecoder(bufio.NewReader(file))
+	for {
+		r := &Record{}
+		err := decoder.Decode(r)
+		if errors.Is(err, io.EOF) {
+			return nil
+		}
+		if err != nil {
+			return fmt.Errorf("decode dead-letter: %w", err)
+		}
+
+		err = fn(r)
+		if err != nil {
+			return err
+		}
+	}
+}
+
+// EncodeValues type bound values.
+func EncodeValues(values []any) []Value {
+	encoded := make([]Value, len(values))
+	for i, v := range values {
+		var data []byte
+		switch v := v.(type) {
+		case string:
+			encoded[i].Type = "text"
+			data, _ = json.Marshal(v)
+		case []byte:
+			encoded[i].Type = "blob"
+			data, _ = json.Marshal(v)
+		case int32:
+			encoded[i].Type = "int"
+			data, _ = json.Marshal(v)
+		case float64:
+			// as string to keep NaN and infinities
+			encoded[i].Type = "double"
+			data, _ = json.Marshal(strconv.FormatFloat(v, 'g', -1, 64))
+		default:
+			encoded[i].Type = "unset"
+		}
+		encoded[i].Value = data
+	}
+	return encoded
+}
+
+// DecodeValues return the bound values of typed values.
+func DecodeValues(encoded []Value) ([]any, error) {
+	values := make([]any, len(encoded))
+	for i, e := range encoded {
+		var err error
+		switch e.Type {
+		case "text":
+			var s string
+			err = json.Unmarshal(e.Value, &s)
+			values[i] = s
+		case "blob":
+			var b []byte
+			err = json.Unmarshal(e.Value, &b)
+			values[i] = b
+		case "int":
+			var n int32
+			err = json.Unmarshal(e.Value, &n)
+			values[i] = n
+		case "double":
+			var s string
+			err = json.Unmarshal(e.Value, &s)
+			if err == nil {
+				values[i], err = strconv.ParseFloat(s, 64)
+			}
+		case "unset":
+			values[i] = &gocql.UnsetValue
+		default:
+			err = fmt.Errorf("unknown type %q", e.Type)
+		}
+		if err != nil {
+			return nil, fmt.Errorf("value %d: %w", i, err)
+		}
+	}
+	return values, nil
+}
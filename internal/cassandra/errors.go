@@ -0,0 +1,81 @@
+package cassandra
+
+import (
+	"errors"
+	"sync"
+	"sync/atomic"
+
+	"github.com/gocql/gocql"
+)
+
+// Failures count failed rows by error class.
+type Failures struct {
+	mu      sync.Mutex
+	classes map[string]*atomic.Uint64
+}
+
+func (f *Failures) Add(class string, n uint64) {
+	f.mu.Lock()
+	if f.classes == nil {
+		f.classes = make(map[string]*atomic.Uint64)
+	}
+	c, ok := f.classes[class]
+	if !ok {
+		c = &atomic.Uint64{}
+		f.classes[class] = c
+	}
+	f.mu.Unlock()
+
+	c.Add(n)
+}
+
+// Counts return a snapshot of the failures by error class.
+func (f *Failures) Counts() map[string]uint64 {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	counts := make(map[string]uint64, len(f.classes))
+	for class, c := range f.classes {
+		counts[class] = c.Load()
+	}
+	return counts
+}
+
+// ErrorClass return the class of a query error, with the consistency outcome
+// for the coordinator errors (as "write_timeout/LOCAL_QUORUM").
+func ErrorClass(err error) string {
+	var (
+		writeTimeout *gocql.RequestErrWriteTimeout
+		writeFailure *gocql.RequestErrWriteFailure
+		unavailable  *gocql.RequestErrUnavailable
+		requestError gocql.RequestError
+	)
+
+	switch {
+	case errors.As(err, &writeTimeout):
+		return "write_timeout/" + writeTimeout.Consistency.String()
+	case errors.As(err, &writeFailure):
+		return "write_failure/" + writeFailure.Consistency.String()
+	case errors.As(err, &unavailable):
+		return "unavailable/" + unavailable.Consistency.String()
+	case errors.Is(err, gocql.ErrTimeoutNoResponse):
+		return "client_timeout"
+	case errors.Is(err, gocql.ErrNoConnections):
+		return "no_connections"
+	case errors.As(err, &requestError) && requestError.Code() == gocql.ErrCodeOverloaded:
+		return "overloaded"
+	case errors.As(err, &requestError) && requestError.Code() == gocql.ErrCodeInvalid:
+		return "invalid"
+	}
+	return "other"
+}
+
+// Backpressure return true if the error shows an overwhelmed cluster (timeouts or overloaded).
+func Backpressure(err error) bool {
+	var writeTimeout *gocql.RequestErrWriteTimeout
+	var requestError gocql.RequestError
+
+	return errors.As(err, &writeTimeout) ||
+		errors.Is(err, gocql.ErrTimeoutNoResponse) ||
+		(errors.As(err, &requestError) && requestError.Code() == gocql.ErrCodeOverloaded)
+}
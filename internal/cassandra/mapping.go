@@ -0,0 +1,124 @@
+package cassandra
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"maps"
+	"os"
+	"slices"
+	"strings"
+)
+
+type Mapping struct {
+	Rename map[string]string // sstable column -> table column
+	Drop   []string          // sstable columns not loaded
+	Set    map[string]string // table column -> cql literal
+}
+
+// ReadFile merge a mapping file into the mapping, one directive per line:
+//
+//	rename <sstable column> <table column>
+//	drop <sstable column>
+//	set <table column> <cql literal>
+func (m *Mapping) ReadFile(path string) error {
+	file, err := os.Open(path)
+	if err != nil {
+		return fmt.Errorf("open mapping-file: %w", err)
+	}
+	defer file.Close()
+
+	if m.Rename == nil {
+		m.Rename = make(map[string]string)
+	}
+	if m.Set == nil {
+		m.Set = make(map[string]string)
+	}
+
+	scanner := bufio.NewScanner(file)
+	for n := 1; scanner.Scan(); n++ {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+
+		fields := strings.SplitN(line, " ", 3)
+		switch {
+		case fields[0] == "rename" && len(fields) == 3:
+			m.Rename[fields[1]] = strings.TrimSpace(fields[2])
+		case fields[0] == "drop" && len(fields) == 2:
+			m.Drop = append(m.Drop, fields[1])
+		case fields[0] == "set" && len(fields) == 3:
+			m.Set[fields[1]] = strings.TrimSpace(fields[2])
+		default:
+			return fmt.Errorf("mapping-file line %d: invalid directive %q", n, line)
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return fmt.Errorf("read mapping-file: %w", err)
+	}
+
+	return nil
+}
+
+// Validate check the mapping against sstable columns and target table columns.
+func (m *Mapping) Validate(sstColumns []string, columns []Column) error {
+	var errs []error
+
+	kinds := make(map[string]string, len(columns))
+	for _, c := range columns {
+		kinds[c.Name] = c.Kind
+	}
+
+	loaded := make(map[string]string)
+	for _, c := range sstColumns {
+		if slices.Contains(m.Drop, c) {
+			continue
+		}
+		target := m.Column(c)
+		if prev, ok := loaded[target]; ok {
+			errs = append(errs, fmt.Errorf("columns %s and %s both map to %s", prev, c, target))
+		}
+		loaded[target] = c
+	}
+
+	for _, src := range slices.Sorted(maps.Keys(m.Rename)) {
+		dst := m.Rename[src]
+		if !slices.Contains(sstColumns, src) {
+			errs = append(errs, fmt.Errorf("rename %s: no such sstable column", src))
+		}
+		if kind, ok := kinds[dst]; !ok || kind == KindPartitionKey || kind == KindClustering {
+			errs = append(errs, fmt.Errorf("rename %s: %s is not a regular column of the table", src, dst))
+		}
+	}
+
+	for _, c := range m.Drop {
+		if !slices.Contains(sstColumns, c) {
+			errs = append(errs, fmt.Errorf("drop %s: no such sstable column", c))
+		}
+	}
+
+	for _, c := range slices.Sorted(maps.Keys(m.Set)) {
+		if kind, ok := kinds[c]; !ok || kind == KindPartitionKey || kind == KindClustering {
+			errs = append(errs, fmt.Errorf("set %s: not a regular column of the table", c))
+		}
+		if src, ok := loaded[c]; ok {
+			errs = append(errs, fmt.Errorf("set %s: column already loaded from sstable column %s", c, src))
+		}
+	}
+
+	return errors.Join(errs...)
+}
+
+// Column return the table column an sstable column is loaded into.
+func (m *Mapping) Column(name string) string {
+	if dst, ok := m.Rename[name]; ok {
+		return dst
+	}
+	return name
+}
+
+// Dropped return true if the sstable column is not loaded.
+func (m *Mapping) Dropped(name string) bool {
+	return slices.Contains(m.Drop, name)
+}
@@ -0,0 +1,167 @@
+package cassandra
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+
+	"github.com/gocql/gocql"
+
+	"sstloader/pkg/sstable"
+)
+
+const (
+	KindPartitionKey = "partition_key"
+	KindClustering   = "clustering"
+	KindRegular      = "regular"
+	KindStatic       = "static"
+)
+
+type Column struct {
+	Name     string
+	Kind     string
+	Position int
+	Type     string
+	Order    string // clustering order, asc or desc
+}
+
+// columns get the target table columns from the schema file or the cluster.
+func (cl *CassandraLoader) columns() ([]Column, error) {
+	if cl.Schema != "" {
+		table, err := ReadSchemaFile(cl.Schema)
+		if err != nil {
+			return nil, err
+		}
+		if cl.KS == "" {
+			cl.KS = table.Keyspace
+		}
+		if cl.Table == "" {
+			cl.Table = table.Name
+		}
+		return table.Columns, nil
+	}
+
+	if cl.session == nil {
+		return nil, errors.New("no cluster connection, a schema file is needed")
+	}
+
+	return cl.readColumns()
+}
+
+// readColumns get the target table columns from system_schema.
+func (cl *CassandraLoader) readColumns() ([]Column, error) {
+	var (
+		columns []Column
+		c       Column
+	)
+
+	// only the load reads the schema, the schema consistency is not needed otherwise
+	consistency, err := gocql.ParseConsistencyWrapper(cl.SchemaConsistency)
+	if err != nil {
+		return nil, fmt.Errorf("schema consistency: %w", err)
+	}
+
+	req := "SELECT column_name, kind, position, type, clustering_order FROM system_schema.columns " +
+		"where keyspace_name = ? and table_name = ?"
+	iter := cl.session.Query(req, cl.KS, cl.Table).Consistency(consistency).Iter()
+	for iter.Scan(&c.Name, &c.Kind, &c.Position, &c.Type, &c.Order) {
+		columns = append(columns, c)
+	}
+	if err := iter.Close(); err != nil {
+		return nil, fmt.Errorf("read table columns: %w", err)
+	}
+	if len(columns) == 0 {
+		return nil, fmt.Errorf("table %s.%s not found", cl.KS, cl.Table)
+	}
+
+	return columns, nil
+}
+
+// keys return the table columns of a kind in key order.
+func keys(columns []Column, kind string) []Column {
+	var ks []Column
+	for _, c := range columns {
+		if c.Kind == kind {
+			ks = append(ks, c)
+		}
+	}
+
+	// keys in declaration order
+	sort.SliceStable(ks, func(i, j int) bool {
+		return ks[i].Position < ks[j].Position
+	})
+
+	return ks
+}
+
+// validateSchema compare the sstable serialization header with the table columns.
+// All incompatibilities are reported.
+func validateSchema(schema *sstable.Schema, columns []Column, mapping *Mapping) error {
+	var errs []error
+
+	// partition key
+	pks := keys(columns, KindPartitionKey)
+	if len(pks) != len(schema.PartitionKey) {
+		errs = append(errs, fmt.Errorf("partition key: %d components in sstable, %d in table",
+			len(schema.PartitionKey), len(pks)))
+	}
+	for i := 0; i < min(len(pks), len(schema.PartitionKey)); i++ {
+		t, _ := sstable.CQLType(schema.PartitionKey[i])
+		if t != pks[i].Type {
+			errs = append(errs, fmt.Errorf("partition key %s: type %s in sstable, %s in table", pks[i].Name, t, pks[i].Type))
+		}
+		if schema.PartitionKey[i] != sstable.MarshalPrefix+"UTF8Type" {
+			errs = append(errs, fmt.Errorf("partition key %s: type %s not supported", pks[i].Name, t))
+		}
+	}
+
+	// clustering key
+	cks := keys(columns, KindClustering)
+	if len(cks) != len(schema.Clustering) {
+		errs = append(errs, fmt.Errorf("clustering key: %d columns in sstable, %d in table",
+			len(schema.Clustering), len(cks)))
+	}
+	if len(schema.Clustering) > 1 {
+		errs = append(errs, fmt.Errorf("clustering key: %d columns, only one supported", len(schema.Clustering)))
+	}
+	for i := 0; i < min(len(cks), len(schema.Clustering)); i++ {
+		t, reversed := sstable.CQLType(schema.Clustering[i])
+		if t != cks[i].Type {
+			errs = append(errs, fmt.Errorf("clustering key %s: type %s in sstable, %s in table", cks[i].Name, t, cks[i].Type))
+		}
+		if reversed != (cks[i].Order == "desc") {
+			errs = append(errs, fmt.Errorf("clustering key %s: order differs between sstable and table", cks[i].Name))
+		}
+		if t != "text" {
+			errs = append(errs, fmt.Errorf("clustering key %s: type %s not supported", cks[i].Name, t))
+		}
+	}
+
+	// regular columns
+	byName := make(map[string]Column, len(columns))
+	for _, c := range columns {
+		byName[c.Name] = c
+	}
+	for _, sc := range schema.Columns {
+		if mapping.Dropped(sc.Name) {
+			continue
+		}
+
+		name := mapping.Column(sc.Name)
+		t, _ := sstable.CQLType(sc.Type)
+		c, ok := byName[name]
+		switch {
+		case !ok:
+			errs = append(errs, fmt.Errorf("column %s: not in table", name))
+		case c.Kind != KindRegular:
+			errs = append(errs, fmt.Errorf("column %s: regular in sstable, %s in table", name, c.Kind))
+		case t != c.Type:
+			errs = append(errs, fmt.Errorf("column %s: type %s in sstable, %s in table", name, t, c.Type))
+		}
+		if !sstable.Supported(sc.Type) {
+			errs = append(errs, fmt.Errorf("column %s: type %s not supported", sc.Name, t))
+		}
+	}
+
+	return errors.Join(errs...)
+}
@@ -0,0 +1,95 @@
+package cassandra
+
+import (
+	"strings"
+	"testing"
+
+	"sstloader/pkg/sstable"
+)
+
+func TestValidateSchema(t *testing.T) {
+	text := sstable.MarshalPrefix + "UTF8Type"
+	int32Type := sstable.MarshalPrefix + "Int32Type"
+	desc := func(t string) string { return sstable.ReversedType + "(" + t + ")" }
+	columns := func(t *testing.T, ddl string) []Column {
+		table, err := ParseCreateTable(ddl)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return table.Columns
+	}
+
+	tests := []struct {
+		name    string
+		ddl     string
+		schema  sstable.Schema
+		mapping Mapping
+		errs    []string // errors expected, none if empty
+	}{
+		{
+			name:   "same schema",
+			ddl:    "CREATE TABLE t (id text, ck text, a text, b int, PRIMARY KEY (id, ck)) WITH CLUSTERING ORDER BY (ck DESC)",
+			schema: sstable.Schema{PartitionKey: []string{text}, Clustering: []string{desc(text)}, Columns: []sstable.SchemaEntry{{Name: "a", Type: text}, {Name: "b", Type: int32Type}}},
+		},
+		{
+			name:   "no clustering column",
+			ddl:    "CREATE TABLE t (id text PRIMARY KEY, a text)",
+			schema: sstable.Schema{PartitionKey: []string{text}, Columns: []sstable.SchemaEntry{{Name: "a", Type: text}}},
+		},
+		{
+			name:   "several clustering columns",
+			ddl:    "CREATE TABLE t (id text, c1 text, c2 text, a text, PRIMARY KEY (id, c1, c2))",
+			schema: sstable.Schema{PartitionKey: []string{text}, Clustering: []string{text, text}, Columns: []sstable.SchemaEntry{{Name: "a", Type: text}}},
+			errs:   []string{"clustering key: 2 columns, only one supported"},
+		},
+		{
+			name:   "keys differ",
+			ddl:    "CREATE TABLE t (id int, ck text, a text, PRIMARY KEY (id, ck))",
+			schema: sstable.Schema{PartitionKey: []string{int32Type}, Clustering: []string{desc(int32Type)}, Columns: []sstable.SchemaEntry{{Name: "a", Type: text}}},
+			errs: []string{
+				"partition key id: type int not supported",
+				"clustering key ck: type int in sstable, text in table",
+				"clustering key ck: order differs",
+				"clustering key ck: type int not supported",
+			},
+		},
+		{
+			name:   "key columns count differ",
+			ddl:    "CREATE TABLE t (id text, ck text, a text, PRIMARY KEY (id, ck))",
+			schema: sstable.Schema{PartitionKey: []string{text, text}, Columns: []sstable.SchemaEntry{{Name: "a", Type: text}}},
+			errs:   []string{"partition key: 2 components in sstable, 1 in table", "clustering key: 0 columns in sstable, 1 in table"},
+		},
+		{
+			name:   "columns differ",
+			ddl:    "CREATE TABLE t (id text PRIMARY KEY, a int, s text static)",
+			schema: sstable.Schema{PartitionKey: []string{text}, Columns: []sstable.SchemaEntry{{Name: "a", Type: text}, {Name: "b", Type: text}, {Name: "s", Type: text}}},
+			errs:   []string{"column a: type text in sstable, int in table", "column b: not in table", "column s: regular in sstable, static in table"},
+		},
+		{
+			name:    "mapped columns",
+			ddl:     "CREATE TABLE t (id text PRIMARY KEY, c text)",
+			schema:  sstable.Schema{PartitionKey: []string{text}, Columns: []sstable.SchemaEntry{{Name: "a", Type: text}, {Name: "b", Type: sstable.MarshalPrefix + "BytesType"}}},
+			mapping: Mapping{Rename: map[string]string{"a": "c"}, Drop: []string{"b"}},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			err := validateSchema(&test.schema, columns(t, test.ddl), &test.mapping)
+			if len(test.errs) == 0 {
+				if err != nil {
+					t.Fatal(err)
+				}
+				return
+			}
+			if err == nil {
+				t.Fatal("no error")
+			}
+			for _, want := range test.errs {
+				if !strings.Contains(err.Error(), want) {
+					t.Errorf("error %q, want %q", err, want)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,62 @@
+package cassandra
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"strconv"
+	"strings"
+)
+
+const DefaultPort = 9042
+
+// Hosts split a comma separated list of host[:port] seeds into host:port addresses.
+// Names are kept as is: the driver resolves them, and uses them as tls server names.
+// Unusable seeds are reported in the error, along with the usable ones.
+func Hosts(seeds string, port int) ([]string, error) {
+	var (
+		hosts []string
+		errs  []error
+	)
+
+	if port == 0 {
+		port = DefaultPort
+	}
+
+	for _, seed := range strings.FieldsFunc(seeds, func(r rune) bool { return r == ',' || r == ' ' }) {
+		host, p, err := splitHostPort(seed, port)
+		if err != nil {
+			errs = append(errs, err)
+			continue
+		}
+
+		hosts = append(hosts, net.JoinHostPort(host, strconv.Itoa(p)))
+	}
+
+	if len(hosts) == 0 {
+		errs = append(errs, errors.New("no usable seed"))
+	}
+
+	return hosts, errors.Join(errs...)
+}
+
+// splitHostPort accept host, host:port, ipv6 and [ipv6]:port.
+func splitHostPort(seed string, port int) (string, int, error) {
+	if strings.Count(seed, ":") > 1 && !strings.HasPrefix(seed, "[") {
+		return seed, port, nil // bare ipv6
+	}
+	if !strings.Contains(seed, ":") {
+		return seed, port, nil
+	}
+
+	host, p, err := net.SplitHostPort(seed)
+	if err != nil {
+		return "", 0, fmt.Errorf("seed %s: %w", seed, err)
+	}
+	port, err = strconv.Atoi(p)
+	if err != nil || port <= 0 || port > 65535 {
+		return "", 0, fmt.Errorf("seed %s: invalid port", seed)
+	}
+
+	return host, port, nil
+}
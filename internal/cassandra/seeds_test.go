@@ -0,0 +1,35 @@
+package cassandra
+
+import (
+	"slices"
+	"testing"
+)
+
+func TestHosts(t *testing.T) {
+	tests := []struct {
+		name  string
+		seeds string
+		port  int
+		hosts []string
+		err   bool
+	}{
+		{"names are not resolved", "cassandra-1.example,localhost", 0, []string{"cassandra-1.example:9042", "localhost:9042"}, false},
+		{"ports", "10.0.0.1:9142 10.0.0.2", 9043, []string{"10.0.0.1:9142", "10.0.0.2:9043"}, false},
+		{"ipv6", "::1,[fe80::1]:9142", 0, []string{"[::1]:9042", "[fe80::1]:9142"}, false},
+		{"invalid port reported", "host:x,other", 0, []string{"other:9042"}, true},
+		{"no usable seed", "host:0", 0, nil, true},
+		{"no seed", "", 0, nil, true},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			hosts, err := Hosts(test.seeds, test.port)
+			if !slices.Equal(hosts, test.hosts) {
+				t.Errorf("hosts %v, want %v", hosts, test.hosts)
+			}
+			if (err != nil) != test.err {
+				t.Errorf("error %v", err)
+			}
+		})
+	}
+}
@@ -0,0 +1,217 @@
+package cassandra
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"io"
+	"math/big"
+	"net"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// testCA is a certificate authority issuing server and client certificates.
+type testCA struct {
+	cert *x509.Certificate
+	key  *ecdsa.PrivateKey
+	pem  []byte
+}
+
+func newTestCA(t *testing.T, name string) *testCA {
+	t.Helper()
+
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	template := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: name},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		KeyUsage:              x509.KeyUsageCertSign,
+		IsCA:                  true,
+		BasicConstraintsValid: true,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cert, err := x509.ParseCertificate(der)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return &testCA{cert: cert, key: key, pem: pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der})}
+}
+
+// issue return a certificate and key pem signed by the ca, for a server name or a client.
+func (ca *testCA) issue(t *testing.T, name string, usage x509.ExtKeyUsage) ([]byte, []byte) {
+	t.Helper()
+
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(time.Now().UnixNano()),
+		Subject:      pkix.Name{CommonName: name},
+		DNSNames:     []string{name},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		KeyUsage:     x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:  []x509.ExtKeyUsage{usage},
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, ca.cert, &key.PublicKey, ca.key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	keyDER, err := x509.MarshalECPrivateKey(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}),
+		pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDER})
+}
+
+// writeFile write data to a file of the test directory and return its path.
+func writeFile(t *testing.T, dir, name string, data []byte) string {
+	t.Helper()
+
+	path := filepath.Join(dir, name)
+	err := os.WriteFile(path, data, 0600)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+// listenTLS start a tls server of the certificate named cassandra.local requiring a client certificate of the ca,
+// it writes "ok" to the connections whose handshake succeeded.
+func listenTLS(t *testing.T, server, clients *testCA) string {
+	t.Helper()
+
+	certPEM, keyPEM := server.issue(t, "cassandra.local", x509.ExtKeyUsageServerAuth)
+	cert, err := tls.X509KeyPair(certPEM, keyPEM)
+	if err != nil {
+		t.Fatal(err)
+	}
+	pool := x509.NewCertPool()
+	pool.AddCert(clients.cert)
+
+	ln, err := tls.Listen("tcp", "127.0.0.1:0", &tls.Config{
+		Certificates: []tls.Certificate{cert},
+		ClientAuth:   tls.RequireAndVerifyClientCert,
+		ClientCAs:    pool,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { ln.Close() })
+
+	go func() {
+		for {
+			conn, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			go func() {
+				defer conn.Close()
+				if conn.(*tls.Conn).Handshake() == nil {
+					conn.Write([]byte("ok"))
+				}
+			}()
+		}
+	}()
+
+	return ln.Addr().String()
+}
+
+// dial connect with the tls options and read the server greeting.
+func dial(addr string, t *TLS) error {
+	config, err := t.Config()
+	if err != nil {
+		return err
+	}
+	conn, err := tls.DialWithDialer(&net.Dialer{Timeout: 5 * time.Second}, "tcp", addr, config)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+	conn.SetDeadline(time.Now().Add(5 * time.Second))
+
+	buf := make([]byte, 2)
+	_, err = io.ReadFull(conn, buf)
+	return err
+}
+
+func TestTLSConfig(t *testing.T) {
+	dir := t.TempDir()
+	ca := newTestCA(t, "test ca")
+	other := newTestCA(t, "other ca")
+	addr := listenTLS(t, ca, ca)
+
+	caFile := writeFile(t, dir, "ca.pem", ca.pem)
+	otherFile := writeFile(t, dir, "other.pem", other.pem)
+	certPEM, keyPEM := ca.issue(t, "loader", x509.ExtKeyUsageClientAuth)
+	certFile := writeFile(t, dir, "client.pem", certPEM)
+	keyFile := writeFile(t, dir, "client.key", keyPEM)
+	otherPEM, otherKeyPEM := other.issue(t, "loader", x509.ExtKeyUsageClientAuth)
+	otherCertFile := writeFile(t, dir, "other-client.pem", otherPEM)
+	otherKeyFile := writeFile(t, dir, "other-client.key", otherKeyPEM)
+
+	tests := []struct {
+		name string
+		tls  TLS
+		ok   bool
+	}{
+		// the server is dialed by ip, its certificate name is only checked with VerifyHost
+		{"ca only", TLS{CA: caFile, Cert: certFile, Key: keyFile}, true},
+		{"ca only of another ca", TLS{CA: otherFile, Cert: certFile, Key: keyFile}, false},
+		{"verify host", TLS{CA: caFile, Cert: certFile, Key: keyFile, VerifyHost: true, ServerName: "cassandra.local"}, true},
+		{"verify host of another name", TLS{CA: caFile, Cert: certFile, Key: keyFile, VerifyHost: true, ServerName: "other.local"}, false},
+		{"verify host of the ip", TLS{CA: caFile, Cert: certFile, Key: keyFile, VerifyHost: true}, false},
+		{"no ca", TLS{Cert: certFile, Key: keyFile}, true},
+		{"no client certificate", TLS{CA: caFile}, false},
+		{"client certificate of another ca", TLS{CA: caFile, Cert: otherCertFile, Key: otherKeyFile}, false},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			err := dial(addr, &test.tls)
+			if test.ok && err != nil {
+				t.Errorf("connection failed: %v", err)
+			}
+			if !test.ok && err == nil {
+				t.Error("connection succeeded")
+			}
+		})
+	}
+}
+
+func TestTLSConfigFiles(t *testing.T) {
+	dir := t.TempDir()
+	empty := writeFile(t, dir, "empty.pem", []byte("no certificate"))
+
+	tests := []struct {
+		name string
+		tls  TLS
+	}{
+		{"missing ca", TLS{CA: filepath.Join(dir, "missing.pem")}},
+		{"ca without certificate", TLS{CA: empty}},
+		{"client certificate without key", TLS{Cert: empty}},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			_, err := test.tls.Config()
+			if err == nil {
+				t.Error("no error")
+			}
+		})
+	}
+}
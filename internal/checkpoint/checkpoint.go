@@ -0,0 +1,195 @@
+package checkpoint
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"log/slog"
+	"os"
+	"sync"
+	"time"
+
+	"sstloader/pkg/sstable"
+)
+
+// State is the checkpoint file content.
+type State struct {
+	Files map[string]int64 `json:"files"` // data file -> offset of the first partition not loaded
+}
+
+// Checkpoint track acknowledged partitions, completed out of order by the workers,
+// and save periodically the offset before which everything has been loaded.
+type Checkpoint struct {
+	Path   string
+	Logger *slog.Logger
+
+	mu      sync.Mutex
+	state   State
+	files   map[string]*tracker
+	stop    chan struct{}
+	stopped chan struct{}
+}
+
+type tracker struct {
+	pending map[int64]int   // from -> batches not yet acknowledged
+	done    map[int64]int64 // from -> end of fully loaded partitions
+	failed  bool            // a partition failed, the offset can't go past it
+	limit   int64           // first failed partition
+}
+
+// New return a checkpoint saved to path, or only kept in memory without path.
+// When resuming, the previous state is read from it.
+func New(path string, resume bool) (*Checkpoint, error) {
+	cp := &Checkpoint{
+		Path:   path,
+		Logger: slog.Default(),
+		state:  State{Files: make(map[string]int64)},
+		files:  make(map[string]*tracker),
+	}
+
+	if !resume || path == "" {
+		return cp, nil
+	}
+
+	data, err := os.ReadFile(path)
+	if errors.Is(err, fs.ErrNotExist) {
+		return cp, nil // nothing loaded yet
+	}
+	if err != nil {
+		return nil, fmt.Errorf("read checkpoint: %w", err)
+	}
+	err = json.Unmarshal(data, &cp.state)
+	if err != nil {
+		return nil, fmt.Errorf("decode checkpoint: %w", err)
+	}
+	if cp.state.Files == nil {
+		cp.state.Files = make(map[string]int64)
+	}
+
+	return cp, nil
+}
+
+// Offset return the offset to resume a data file from.
+func (cp *Checkpoint) Offset(file string) int64 {
+	cp.mu.Lock()
+	defer cp.mu.Unlock()
+	return cp.state.Files[file]
+}
+
+// Done acknowledge a batch, ok if all its rows were loaded.
+func (cp *Checkpoint) Done(b *sstable.Batch, ok bool) {
+	cp.mu.Lock()
+	defer cp.mu.Unlock()
+
+	t, found := cp.files[b.Source]
+	if !found {
+		t = &tracker{
+			pending: make(map[int64]int),
+			done:    make(map[int64]int64),
+		}
+		cp.files[b.Source] = t
+	}
+
+	// a failed partition is never acknowledged, loading resume from it,
+	// partitions after it don't need to be tracked anymore
+	if !ok && (!t.failed || b.From < t.limit) {
+		t.failed = true
+		t.limit = b.From
+		for from := range t.pending {
+			if from >= t.limit {
+				delete(t.pending, from)
+			}
+		}
+		for from := range t.done {
+			if from >= t.limit {
+				delete(t.done, from)
+			}
+		}
+	}
+	if t.failed && b.From >= t.limit {
+		return
+	}
+
+	n, found := t.pending[b.From]
+	if !found {
+		n = b.Parts
+	}
+	n--
+	if n > 0 {
+		t.pending[b.From] = n
+		return
+	}
+	delete(t.pending, b.From)
+	t.done[b.From] = b.End
+
+	// advance over contiguous loaded partitions
+	offset := cp.state.Files[b.Source]
+	for {
+		end, found := t.done[offset]
+		if !found {
+			break
+		}
+		delete(t.done, offset)
+		offset = end
+	}
+	cp.state.Files[b.Source] = offset
+}
+
+// Save write the state atomically.
+func (cp *Checkpoint) Save() error {
+	if cp.Path == "" {
+		return nil
+	}
+
+	cp.mu.Lock()
+	data, err := json.Marshal(&cp.state)
+	cp.mu.Unlock()
+	if err != nil {
+		return fmt.Errorf("encode checkpoint: %w", err)
+	}
+
+	tmp := cp.Path + ".tmp"
+	err = os.WriteFile(tmp, data, 0o600)
+	if err != nil {
+		return fmt.Errorf("write checkpoint: %w", err)
+	}
+	err = os.Rename(tmp, cp.Path)
+	if err != nil {
+		return fmt.Errorf("write checkpoint: %w", err)
+	}
+
+	return nil
+}
+
+// Start save the state every interval until Stop.
+func (cp *Checkpoint) Start(interval time.Duration) {
+	cp.stop = make(chan struct{})
+	cp.stopped = make(chan struct{})
+
+	go func() {
+		defer close(cp.stopped)
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ticker.C:
+				err := cp.Save()
+				if err != nil {
+					cp.Logger.Error("checkpoint", "error", err)
+				}
+			case <-cp.stop:
+				return
+			}
+		}
+	}()
+}
+
+// Stop the periodic save and save the final state.
+func (cp *Checkpoint) Stop() error {
+	if cp.stop != nil {
+		close(cp.stop)
+		<-cp.stopped
+	}
+	return cp.Save()
+}
@@ -0,0 +1,97 @@
+package checkpoint
+
+import (
+	"path/filepath"
+	"testing"
+	"time"
+
+	"sstloader/pkg/sstable"
+)
+
+// ack of a batch of partitions loaded from the offset from to end, in parts batches
+type ack struct {
+	from, end int64
+	parts     int
+	ok        bool
+}
+
+func TestDone(t *testing.T) {
+	tests := []struct {
+		name   string
+		acks   []ack
+		offset int64
+	}{
+		{"in order", []ack{{0, 10, 1, true}, {10, 20, 1, true}, {20, 30, 1, true}}, 30},
+		{"out of order", []ack{{20, 30, 1, true}, {0, 10, 1, true}}, 10},
+		{"out of order completed", []ack{{20, 30, 1, true}, {10, 20, 1, true}, {0, 10, 1, true}}, 30},
+		{"partition in parts", []ack{{0, 10, 3, true}, {0, 10, 3, true}, {10, 20, 1, true}}, 0},
+		{"partition in parts completed", []ack{{0, 10, 3, true}, {10, 20, 1, true}, {0, 10, 3, true}, {0, 10, 3, true}}, 20},
+		{"failed batch", []ack{{0, 10, 1, true}, {10, 20, 1, false}, {20, 30, 1, true}}, 10},
+		{"failed batch before loaded ones", []ack{{20, 30, 1, true}, {30, 40, 1, true}, {10, 20, 1, false}, {0, 10, 1, true}}, 10},
+		{"failed part of a partition", []ack{{0, 10, 2, true}, {0, 10, 2, false}, {10, 20, 1, true}}, 0},
+		{"earlier failed batch", []ack{{20, 30, 1, false}, {10, 20, 1, false}, {0, 10, 1, true}}, 10},
+		{"later failed batch", []ack{{10, 20, 1, false}, {20, 30, 1, false}, {0, 10, 1, true}, {10, 20, 1, true}}, 10},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			cp, err := New("", false)
+			if err != nil {
+				t.Fatal(err)
+			}
+			for _, a := range test.acks {
+				cp.Done(&sstable.Batch{Source: "a-Data.db", From: a.from, End: a.end, Parts: a.parts}, a.ok)
+			}
+			if offset := cp.Offset("a-Data.db"); offset != test.offset {
+				t.Errorf("offset %d, want %d", offset, test.offset)
+			}
+			if offset := cp.Offset("b-Data.db"); offset != 0 {
+				t.Errorf("offset of another file %d, want 0", offset)
+			}
+		})
+	}
+}
+
+func TestResume(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "checkpoint.json")
+
+	// nothing saved yet
+	cp, err := New(path, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if offset := cp.Offset("a-Data.db"); offset != 0 {
+		t.Fatalf("offset %d without checkpoint, want 0", offset)
+	}
+
+	cp.Done(&sstable.Batch{Source: "a-Data.db", From: 0, End: 10, Parts: 1}, true)
+	cp.Done(&sstable.Batch{Source: "a-Data.db", From: 20, End: 30, Parts: 1}, true)
+	cp.Done(&sstable.Batch{Source: "b-Data.db", From: 0, End: 5, Parts: 1}, true)
+	cp.Start(time.Hour)
+	err = cp.Stop()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// loading resumes from the saved offsets, and goes on from them
+	cp, err = New(path, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if a, b := cp.Offset("a-Data.db"), cp.Offset("b-Data.db"); a != 10 || b != 5 {
+		t.Fatalf("resumed offsets %d and %d, want 10 and 5", a, b)
+	}
+	cp.Done(&sstable.Batch{Source: "a-Data.db", From: 10, End: 20, Parts: 1}, true)
+	if offset := cp.Offset("a-Data.db"); offset != 20 {
+		t.Errorf("offset %d after resume, want 20", offset)
+	}
+
+	// a new load starts over
+	cp, err = New(path, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if offset := cp.Offset("a-Data.db"); offset != 0 {
+		t.Errorf("offset %d without resume, want 0", offset)
+	}
+}
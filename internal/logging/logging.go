@@ -0,0 +1,88 @@
+package logging
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"log/slog"
+	"strings"
+)
+
+// Logging build the loggers of the components, sharing one output.
+type Logging struct {
+	handler slog.Handler
+	level   slog.Level            // default level
+	levels  map[string]slog.Level // component -> level
+}
+
+// New return loggers writing text or json to out,
+// levels is a default level and component overrides, as "info,sstable=debug".
+func New(out io.Writer, format, levels string) (*Logging, error) {
+	l := &Logging{level: slog.LevelInfo, levels: make(map[string]slog.Level)}
+
+	for _, spec := range strings.Split(levels, ",") {
+		spec = strings.TrimSpace(spec)
+		if spec == "" {
+			continue
+		}
+		component, name, ok := strings.Cut(spec, "=")
+		if !ok {
+			name, component = component, ""
+		}
+
+		var level slog.Level
+		err := level.UnmarshalText([]byte(name))
+		if err != nil {
+			return nil, fmt.Errorf("log level %q: %w", spec, err)
+		}
+		if component == "" {
+			l.level = level
+		} else {
+			l.levels[component] = level
+		}
+	}
+
+	// the handler let everything pass, levels are checked by component
+	opts := &slog.HandlerOptions{Level: slog.LevelDebug}
+	switch format {
+	case "text":
+		l.handler = slog.NewTextHandler(out, opts)
+	case "json":
+		l.handler = slog.NewJSONHandler(out, opts)
+	default:
+		return nil, fmt.Errorf("log format %q: expected text or json", format)
+	}
+
+	return l, nil
+}
+
+// Logger return the logger of a component.
+func (l *Logging) Logger(component string) *slog.Logger {
+	level, ok := l.levels[component]
+	if !ok {
+		level = l.level
+	}
+	return slog.New(&levelHandler{level: level, handler: l.handler}).With("component", component)
+}
+
+// levelHandler filter records below a level before anything is formatted.
+type levelHandler struct {
+	level   slog.Level
+	handler slog.Handler
+}
+
+func (h *levelHandler) Enabled(_ context.Context, level slog.Level) bool {
+	return level >= h.level
+}
+
+func (h *levelHandler) Handle(ctx context.Context, r slog.Record) error {
+	return h.handler.Handle(ctx, r)
+}
+
+func (h *levelHandler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	return &levelHandler{level: h.level, handler: h.handler.WithAttrs(attrs)}
+}
+
+func (h *levelHandler) WithGroup(name string) slog.Handler {
+	return &levelHandler{level: h.level, handler: h.handler.WithGroup(name)}
+}
@@ -0,0 +1,128 @@
+package metrics
+
+import (
+	"errors"
+	"fmt"
+	"log/slog"
+	"net"
+	"net/http"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+
+	"sstloader/pkg/sstable"
+)
+
+// Metrics of a load, all labelled with keyspace and table.
+type Metrics struct {
+	Inserted *prometheus.CounterVec   // by sstable
+	Failed   *prometheus.CounterVec   // by sstable and error class
+	InFlight *prometheus.GaugeVec     // by sstable
+	Latency  *prometheus.HistogramVec // by sstable
+
+	Logger *slog.Logger
+
+	registry   *prometheus.Registry
+	registerer prometheus.Registerer
+}
+
+func New(keyspace, table string) *Metrics {
+	m := &Metrics{
+		Inserted: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Name: "sstloader_rows_inserted_total",
+			Help: "Rows successfully inserted.",
+		}, []string{"sstable"}),
+		Failed: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Name: "sstloader_rows_failed_total",
+			Help: "Rows failed to insert, by error class.",
+		}, []string{"sstable", "class"}),
+		InFlight: prometheus.NewGaugeVec(prometheus.GaugeOpts{
+			Name: "sstloader_queries_in_flight",
+			Help: "Queries sent and not yet answered.",
+		}, []string{"sstable"}),
+		Latency: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Name:    "sstloader_query_duration_seconds",
+			Help:    "Query latency, retries included.",
+			Buckets: prometheus.ExponentialBuckets(0.0005, 2, 16),
+		}, []string{"sstable"}),
+		Logger:   slog.Default(),
+		registry: prometheus.NewRegistry(),
+	}
+
+	m.registerer = prometheus.WrapRegistererWith(prometheus.Labels{"keyspace": keyspace, "table": table}, m.registry)
+	m.registerer.MustRegister(m.Inserted, m.Failed, m.InFlight, m.Latency)
+
+	return m
+}
+
+// SSTable register the decoding metrics of an sstable,
+// and the depth of the channel between its decoding and the workers.
+// An sstable read again replaces the metrics of its previous reading.
+func (m *Metrics) SSTable(sst *sstable.SSTable, ch chan sstable.Batch) {
+	labels := prometheus.Labels{"sstable": sst.DataFile}
+
+	collectors := []prometheus.Collector{
+		prometheus.NewCounterFunc(prometheus.CounterOpts{
+			Name:        "sstloader_rows_decoded_total",
+			Help:        "Rows decoded from the sstable.",
+			ConstLabels: labels,
+		}, func() float64 { return float64(sst.Queries.Load()) }),
+		prometheus.NewCounterFunc(prometheus.CounterOpts{
+			Name:        "sstloader_decompressed_bytes_total",
+			Help:        "Bytes of data decompressed from the sstable.",
+			ConstLabels: labels,
+		}, func() float64 { return float64(sst.Decompressed.Load()) }),
+		prometheus.NewGaugeFunc(prometheus.GaugeOpts{
+			Name:        "sstloader_channel_depth",
+			Help:        "Batches decoded waiting for a worker.",
+			ConstLabels: labels,
+		}, func() float64 { return float64(len(ch)) }),
+	}
+	for _, c := range collectors {
+		err := m.registerer.Register(c)
+		var are prometheus.AlreadyRegisteredError
+		if errors.As(err, &are) {
+			m.registerer.Unregister(are.ExistingCollector)
+			err = m.registerer.Register(c)
+		}
+		if err != nil {
+			m.Logger.Warn("register metrics", "sstable", sst.DataFile, "error", err)
+		}
+	}
+}
+
+// Observe account a query of n rows from an sstable, class is empty on success.
+func (m *Metrics) Observe(source string, n int, class string, latency time.Duration) {
+	m.Latency.WithLabelValues(source).Observe(latency.Seconds())
+	if class == "" {
+		m.Inserted.WithLabelValues(source).Add(float64(n))
+	} else {
+		m.Failed.WithLabelValues(source, class).Add(float64(n))
+	}
+}
+
+// Serve expose the metrics over http in background.
+func (m *Metrics) Serve(addr string) error {
+	ln, err := net.Listen("tcp", addr)
+	if err != nil {
+		return fmt.Errorf("listen metrics: %w", err)
+	}
+
+	mux := http.NewServeMux()
+	mux.Handle("/metrics", promhttp.HandlerFor(m.registry, promhttp.HandlerOpts{}))
+
+	server := &http.Server{
+		Handler:           mux,
+		ReadHeaderTimeout: 10 * time.Second,
+	}
+
+	go func() {
+		err := server.Serve(ln)
+		if err != nil && !errors.Is(err, http.ErrServerClosed) {
+			m.Logger.Error("serve metrics", "error", err)
+		}
+	}()
+
+	return nil
+}
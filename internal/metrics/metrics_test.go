@@ -0,0 +1,45 @@
+package metrics
+
+import (
+	"testing"
+
+	"sstloader/pkg/sstable"
+)
+
+func TestSSTableTwice(t *testing.T) {
+	m := New("ks", "t")
+
+	sst := sstable.New()
+	sst.DataFile = "mc-1-big-Data.db"
+	sst.Queries.Store(10)
+	m.SSTable(sst, make(chan sstable.Batch, 1))
+
+	// the same sstable read again replaces the metrics of the first reading
+	again := sstable.New()
+	again.DataFile = sst.DataFile
+	again.Queries.Store(3)
+	m.SSTable(again, make(chan sstable.Batch, 1))
+
+	mfs, err := m.registry.Gather()
+	if err != nil {
+		t.Fatal(err)
+	}
+	found := 0
+	for _, mf := range mfs {
+		switch mf.GetName() {
+		case "sstloader_rows_decoded_total":
+			found++
+			if len(mf.Metric) != 1 || mf.Metric[0].GetCounter().GetValue() != 3 {
+				t.Errorf("rows decoded %v, want one counter of 3", mf.Metric)
+			}
+		case "sstloader_decompressed_bytes_total", "sstloader_channel_depth":
+			found++
+			if len(mf.Metric) != 1 {
+				t.Errorf("%s %v, want one metric", mf.GetName(), mf.Metric)
+			}
+		}
+	}
+	if found != 3 {
+		t.Errorf("%d sstable metrics registered, want 3", found)
+	}
+}
@@ -0,0 +1,130 @@
+package progress
+
+import (
+	"fmt"
+	"os"
+	"strings"
+	"time"
+)
+
+// Counters of the load, read at each report.
+type Counters struct {
+	Bytes  int64  // uncompressed data bytes read
+	Rows   int64  // rows decoded
+	Errors uint64 // rows failed
+}
+
+// Progress report periodically the load progress on a file,
+// as a line refreshed in place on a terminal or as plain log lines otherwise.
+type Progress struct {
+	Total    int64           // uncompressed data bytes to read
+	Interval time.Duration   // between log lines, a terminal is refreshed every second
+	Counters func() Counters // current counters
+	Extra    func() string   // additional information, if any
+	Out      *os.File
+
+	tty     bool
+	start   time.Time
+	stop    chan struct{}
+	stopped chan struct{}
+}
+
+func New(out *os.File, total int64, interval time.Duration, counters func() Counters) *Progress {
+	return &Progress{
+		Out:      out,
+		Total:    total,
+		Interval: interval,
+		Counters: counters,
+		tty:      isTerminal(out),
+	}
+}
+
+// Start report until Stop.
+func (p *Progress) Start() {
+	p.start = time.Now()
+	p.stop = make(chan struct{})
+	p.stopped = make(chan struct{})
+
+	interval := p.Interval
+	if p.tty {
+		interval = time.Second
+	}
+
+	go func() {
+		defer close(p.stopped)
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ticker.C:
+				p.report()
+			case <-p.stop:
+				return
+			}
+		}
+	}()
+}
+
+// Stop reporting, the terminal line is cleared.
+func (p *Progress) Stop() {
+	if p.stop == nil {
+		return
+	}
+	close(p.stop)
+	<-p.stopped
+	if p.tty {
+		fmt.Fprint(p.Out, "\r\033[K")
+	}
+}
+
+func (p *Progress) report() {
+	line := p.Line(time.Since(p.start))
+	if p.tty {
+		fmt.Fprintf(p.Out, "\r\033[K%s", line)
+	} else {
+		fmt.Fprintf(p.Out, "progress %s\n", line)
+	}
+}
+
+// Line format the counters after elapsed time.
+func (p *Progress) Line(elapsed time.Duration) string {
+	c := p.Counters()
+	seconds := elapsed.Seconds()
+
+	var b strings.Builder
+	if p.Total > 0 {
+		fmt.Fprintf(&b, "%5.1f%% ", 100*float64(c.Bytes)/float64(p.Total))
+	}
+	fmt.Fprintf(&b, "%d rows", c.Rows)
+	if seconds > 0 {
+		fmt.Fprintf(&b, " %.0f rows/s %.1f MB/s", float64(c.Rows)/seconds, float64(c.Bytes)/seconds/1e6)
+	}
+	fmt.Fprintf(&b, " %d errors", c.Errors)
+	if p.Extra != nil {
+		fmt.Fprintf(&b, " %s", p.Extra())
+	}
+
+	// remaining bytes at the average rate so far
+	if c.Bytes > 0 && c.Bytes < p.Total {
+		eta := time.Duration(float64(p.Total-c.Bytes) / float64(c.Bytes) * float64(elapsed))
+		fmt.Fprintf(&b, " eta %s", eta.Round(time.Second))
+	}
+
+	return b.String()
+}
+
+// Rate return per second average of n over elapsed, 0 when nothing elapsed.
+func Rate(n int64, elapsed time.Duration) int64 {
+	if elapsed <= 0 {
+		return 0
+	}
+	return int64(float64(n) / elapsed.Seconds())
+}
+
+func isTerminal(f *os.File) bool {
+	fi, err := f.Stat()
+	if err != nil {
+		return false
+	}
+	return fi.Mode()&os.ModeCharDevice != 0
+}
@@ -0,0 +1,32 @@
+package throttle
+
+import (
+	"sync"
+	"time"
+)
+
+// Rate is a fixed rate limiter of units per second (as bytes), taken by any amount.
+type Rate struct {
+	mu   sync.Mutex
+	rate float64
+	next time.Time
+}
+
+func NewRate(rate float64) *Rate {
+	return &Rate{rate: rate}
+}
+
+// TakeN block until n units are allowed, a large amount delays the next takes.
+func (r *Rate) TakeN(n int) time.Time {
+	r.mu.Lock()
+	now := time.Now()
+	if r.next.Before(now) {
+		r.next = now
+	}
+	at := r.next
+	r.next = r.next.Add(time.Duration(float64(n) / r.rate * float64(time.Second)))
+	r.mu.Unlock()
+
+	time.Sleep(time.Until(at))
+	return at
+}
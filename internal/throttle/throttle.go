@@ -0,0 +1,137 @@
+package throttle
+
+import (
+	"math"
+	"slices"
+	"sync"
+	"time"
+)
+
+// max latencies kept by interval to compute the percentile
+const samples = 10000
+
+// Adaptive is a rate limiter adjusting its rate to the cluster backpressure, AIMD style:
+// the rate is decreased by a factor when queries time out, are rejected as overloaded
+// or when the latency percentile exceeds a threshold, and increased by a step otherwise.
+type Adaptive struct {
+	Min        float64       // lowest rate
+	Max        float64       // highest rate
+	Step       float64       // rate added after a healthy interval
+	Factor     float64       // rate multiplier after an interval with backpressure
+	Latency    time.Duration // latency percentile threshold
+	Percentile float64       // latency percentile checked, as 0.99
+	Interval   time.Duration // between adjustments
+
+	mu        sync.Mutex
+	rate      float64
+	next      time.Time
+	queries   int
+	pressure  int
+	latencies []time.Duration
+	stop      chan struct{}
+	stopped   chan struct{}
+}
+
+// New return an adaptive limiter starting at rate per second.
+func New(rate float64) *Adaptive {
+	return &Adaptive{
+		Min:        1,
+		Max:        math.Inf(1),
+		Step:       math.Max(rate/20, 1),
+		Factor:     0.5,
+		Latency:    500 * time.Millisecond,
+		Percentile: 0.99,
+		Interval:   time.Second,
+		rate:       rate,
+	}
+}
+
+// Take block until the next event is allowed at the current rate.
+func (a *Adaptive) Take() time.Time {
+	a.mu.Lock()
+	now := time.Now()
+	if a.next.Before(now) {
+		a.next = now
+	}
+	at := a.next
+	a.next = a.next.Add(time.Duration(float64(time.Second) / a.rate))
+	a.mu.Unlock()
+
+	time.Sleep(time.Until(at))
+	return at
+}
+
+// Rate return the current rate per second.
+func (a *Adaptive) Rate() float64 {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	return a.rate
+}
+
+// Observe account the outcome of a query, backpressure if the cluster was overwhelmed.
+func (a *Adaptive) Observe(latency time.Duration, backpressure bool) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	a.queries++
+	if backpressure {
+		a.pressure++
+	}
+	if len(a.latencies) < samples {
+		a.latencies = append(a.latencies, latency)
+	}
+}
+
+// Start adjust the rate every interval until Stop.
+func (a *Adaptive) Start() {
+	a.stop = make(chan struct{})
+	a.stopped = make(chan struct{})
+
+	go func() {
+		defer close(a.stopped)
+		ticker := time.NewTicker(a.Interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ticker.C:
+				a.adjust()
+			case <-a.stop:
+				return
+			}
+		}
+	}()
+}
+
+// Stop the adjustments, the rate is kept.
+func (a *Adaptive) Stop() {
+	if a.stop != nil {
+		close(a.stop)
+		<-a.stopped
+	}
+}
+
+func (a *Adaptive) adjust() {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	// nothing sent, nothing learned
+	if a.queries == 0 {
+		return
+	}
+
+	slow := false
+	if a.Latency > 0 && len(a.latencies) > 0 {
+		slices.Sort(a.latencies)
+		slow = a.latencies[int(float64(len(a.latencies)-1)*a.Percentile)] > a.Latency
+	}
+
+	if a.pressure > 0 || slow {
+		a.rate = math.Max(a.rate*a.Factor, a.Min)
+	} else {
+		a.rate = math.Min(a.rate+a.Step, a.Max)
+	}
+
+	a.queries = 0
+	a.pressure = 0
+	a.latencies = a.latencies[:0]
+}
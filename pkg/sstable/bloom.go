@@ -0,0 +1,69 @@
+package sstable
+
+import (
+	"encoding/binary"
+	"math"
+)
+
+// bits added to the bloom filter size
+const bloomExcess = 20
+
+// bloom is the partition keys bloom filter of Filter.db,
+// keys are hashed with the partitioner murmur3 as by cassandra.
+type bloom struct {
+	hashes int
+	words  []uint64
+}
+
+// newBloom return a filter for n keys with a false positive chance,
+// sized as cassandra does from buckets by key and hashes giving that chance.
+func newBloom(n int, chance float64) *bloom {
+	buckets, hashes := bloomSpec(chance)
+	size := int64(n)*int64(buckets) + bloomExcess
+	return &bloom{hashes: hashes, words: make([]uint64, (size-1)/64+1)}
+}
+
+// bloomSpec return the lowest buckets by key and then hashes reaching the false positive chance.
+func bloomSpec(chance float64) (int, int) {
+	probability := func(buckets, hashes int) float64 {
+		return math.Pow(1-math.Exp(-float64(hashes)/float64(buckets)), float64(hashes))
+	}
+
+	buckets, hashes := 2, 1
+	for ; buckets < 20; buckets++ {
+		// optimal hashes count for the buckets
+		hashes = max(1, int(math.Round(math.Ln2*float64(buckets))))
+		if probability(buckets, hashes) <= chance {
+			break
+		}
+	}
+	for hashes > 1 && probability(buckets, hashes-1) <= chance {
+		hashes--
+	}
+	return buckets, hashes
+}
+
+// add a key by its murmur3 hash.
+func (b *bloom) add(h1, h2 uint64) {
+	capacity := int64(len(b.words)) * 64
+
+	base, inc := int64(h2), int64(h1)
+	for i := 0; i < b.hashes; i++ {
+		index := base % capacity
+		if index < 0 {
+			index = -index
+		}
+		b.words[index/64] |= 1 << (index % 64)
+		base += inc
+	}
+}
+
+// Append serialize the filter at the end of b: hashes count, words count and words.
+func (b *bloom) Append(buf []byte) []byte {
+	buf = binary.BigEndian.AppendUint32(buf, uint32(b.hashes))
+	buf = binary.BigEndian.AppendUint32(buf, uint32(len(b.words)))
+	for _, w := range b.words {
+		buf = binary.BigEndian.AppendUint64(buf, w)
+	}
+	return buf
+}
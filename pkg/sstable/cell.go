@@ -74,3 +74,26 @@ func (cell *Cell) Read(r io.Reader) (err error) {
 
 	return nil
 }
+
+// Append serialize the cell at the end of b.
+func (cell *Cell) Append(b []byte) []byte {
+	b = append(b, cell.Flags)
+
+	if !GetFlag(cell.Flags, UseRowTimestamp) {
+		b = AppendUvarint(b, cell.Timestamp)
+	}
+	if (GetFlag(cell.Flags, IsDeleted) || GetFlag(cell.Flags, IsExpiring)) && !GetFlag(cell.Flags, UseRowTTL) {
+		b = AppendUvarint(b, cell.LocalDeletionTime)
+	}
+	if GetFlag(cell.Flags, IsExpiring) && !GetFlag(cell.Flags, UseRowTTL) {
+		b = AppendUvarint(b, cell.TTL)
+	}
+
+	if GetFlag(cell.Flags, HasEmptyValue) {
+		return b
+	}
+	if cell.TypeSize == 0 {
+		b = AppendUvarint(b, uint64(len(cell.Value)))
+	}
+	return append(b, cell.Value...)
+}
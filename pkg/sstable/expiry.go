@@ -0,0 +1,54 @@
+package sstable
+
+import "github.com/gocql/gocql"
+
+// LocalDeletionTimeEpoch is the base of the serialization header min local deletion time, 2015-09-22 in seconds.
+const LocalDeletionTimeEpoch int64 = 1442880000
+
+// ExpirationTime return the local expiration time in seconds of a row with a ttl, false if it has none.
+func (row *Row) ExpirationTime(schema *Schema) (int64, bool) {
+	if !GetFlag(row.Flags, HasTTL) {
+		return 0, false
+	}
+	return schema.MinLocalDeletionTime + int64(row.DeletionTime), true
+}
+
+// ExpirationTime return the local expiration time in seconds of an expiring cell, false if it does not expire.
+func (cell *Cell) ExpirationTime(row *Row, schema *Schema) (int64, bool) {
+	if !GetFlag(cell.Flags, IsExpiring) {
+		return 0, false
+	}
+	if GetFlag(cell.Flags, UseRowTTL) {
+		return row.ExpirationTime(schema)
+	}
+	return schema.MinLocalDeletionTime + int64(cell.LocalDeletionTime), true
+}
+
+// expire unset the values of the cells expired at now, and return false if the row is gone:
+// its primary key expired or was only kept alive by cells now expired.
+func (sst *SSTable) expire(values []any, r *Row, now int64) bool {
+	live := false
+	expired := false
+
+	first := len(values) - len(r.Cells)
+	for i := range r.Cells {
+		if values[first+i] == any(&gocql.UnsetValue) {
+			continue
+		}
+		if t, ok := r.Cells[i].ExpirationTime(r, &sst.Schema); ok && now >= t {
+			values[first+i] = &gocql.UnsetValue
+			sst.ExpiredCells.Add(1)
+			expired = true
+		} else {
+			live = true
+		}
+	}
+
+	if live {
+		return true
+	}
+	if t, ok := r.ExpirationTime(&sst.Schema); ok {
+		return now < t
+	}
+	return !expired || GetFlag(r.Flags, HasTimestamp)
+}
@@ -0,0 +1,100 @@
+package sstable
+
+import (
+	"context"
+	"encoding/binary"
+	"testing"
+
+	"github.com/gocql/gocql"
+)
+
+// expiryRow return a row of flags expiring at 1000+deletion with a row ttl, of cells a and b of flags
+// expiring at 1000+their deletion when not sharing the row ttl.
+func expiryRow(flags byte, deletion uint64, aFlags byte, aDeletion uint64, bFlags byte, bDeletion uint64) Row {
+	return Row{
+		Flags:        flags,
+		DeletionTime: deletion,
+		Cells: []Cell{
+			{TypeSize: TextSize, Flags: aFlags, LocalDeletionTime: aDeletion, Value: []byte("x")},
+			{TypeSize: Int32Size, Flags: bFlags, LocalDeletionTime: bDeletion, Value: binary.BigEndian.AppendUint32(nil, 1)},
+		},
+	}
+}
+
+func TestExpire(t *testing.T) {
+	const now = 1100
+	rowTTL := IsExpiring | UseRowTTL
+
+	tests := []struct {
+		name    string
+		row     Row
+		keep    bool
+		unset   []bool // cells unset
+		expired int64  // cells counted as expired
+	}{
+		{"no ttl", expiryRow(HasTimestamp, 0, 0, 0, 0, 0), true, []bool{false, false}, 0},
+		{"row ttl not elapsed", expiryRow(HasTimestamp|HasTTL, 200, rowTTL, 0, rowTTL, 0), true, []bool{false, false}, 0},
+		{"row ttl elapsed", expiryRow(HasTimestamp|HasTTL, 50, rowTTL, 0, rowTTL, 0), false, []bool{true, true}, 2},
+		{"row ttl elapsed now", expiryRow(HasTimestamp|HasTTL, 100, rowTTL, 0, rowTTL, 0), false, []bool{true, true}, 2},
+		{"cell ttl elapsed", expiryRow(HasTimestamp, 0, IsExpiring, 50, 0, 0), true, []bool{true, false}, 1},
+		{"cell ttl elapsed before row ttl", expiryRow(HasTimestamp|HasTTL, 200, IsExpiring, 50, rowTTL, 0), true, []bool{true, false}, 1},
+		{"cells ttl elapsed, row without ttl", expiryRow(HasTimestamp, 0, IsExpiring, 50, IsExpiring, 60), true, []bool{true, true}, 2},
+		{"cells ttl elapsed, no primary key liveness", expiryRow(0, 0, IsExpiring, 50, IsExpiring, 60), false, []bool{true, true}, 2},
+		{"cell ttl elapsed, other cell live", expiryRow(0, 0, IsExpiring, 50, 0, 0), true, []bool{true, false}, 1},
+		{"cell ttl elapsed, other cell missing", expiryRow(0, 0, IsExpiring, 50, HasEmptyValue, 0), false, []bool{true, true}, 1},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			sst := New()
+			sst.Schema = cellsSchema()
+			values := sst.values([]any{[]byte("k")}, &test.row)
+			keep := sst.expire(values, &test.row, now)
+			if keep != test.keep {
+				t.Errorf("kept %v, want %v", keep, test.keep)
+			}
+			for i, unset := range test.unset {
+				if (values[1+i] == any(&gocql.UnsetValue)) != unset {
+					t.Errorf("cell %d value %v, want unset %v", i, values[1+i], unset)
+				}
+			}
+			if sst.ExpiredCells.Load() != test.expired {
+				t.Errorf("%d cells expired, want %d", sst.ExpiredCells.Load(), test.expired)
+			}
+		})
+	}
+}
+
+func TestKeepExpired(t *testing.T) {
+	for _, keep := range []bool{false, true} {
+		sst := New()
+		sst.Schema = cellsSchema()
+		sst.KeepExpired = keep
+		sst.BatchSize = 10
+		sst.BatchBytes = 1 << 20
+
+		// expired long ago
+		partition := &Partition{
+			HeaderKeys: []HeaderKey{{Value: []byte("k")}},
+			Rows:       []Row{expiryRow(HasTimestamp|HasTTL, 0, IsExpiring|UseRowTTL, 0, IsExpiring|UseRowTTL, 0)},
+		}
+		bt := sst.batcher(context.Background(), make(chan Batch))
+		rows := 0
+		for _, b := range bt.batches(partition, Batch{}) {
+			for _, values := range b.Rows {
+				rows++
+				if values[1] != "x" || values[2] != int32(1) {
+					t.Errorf("keep expired %v: row %v, want its values", keep, values)
+				}
+			}
+		}
+
+		want, expired := 0, int64(1)
+		if keep {
+			want, expired = 1, 0
+		}
+		if rows != want || sst.ExpiredRows.Load() != expired {
+			t.Errorf("keep expired %v: %d rows loaded, %d expired, want %d and %d", keep, rows, sst.ExpiredRows.Load(), want, expired)
+		}
+	}
+}
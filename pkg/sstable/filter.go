@@ -0,0 +1,68 @@
+package sstable
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"regexp"
+	"strings"
+)
+
+// Filter select partitions, a partition is read if it matches all the filters set.
+type Filter struct {
+	Keys   map[string]bool // partition keys, as formatted by FormatKey
+	Tokens bool            // select the token range (Start, End], wrapping around if Start >= End
+	Start  int64
+	End    int64
+	Regexp *regexp.Regexp // on the formatted partition key
+}
+
+// Match return true if the partition of token and key components is selected.
+func (f *Filter) Match(token int64, components [][]byte, types []string) bool {
+	if f.Tokens {
+		if f.Start < f.End && (token <= f.Start || token > f.End) {
+			return false
+		}
+		if f.Start >= f.End && token <= f.Start && token > f.End {
+			return false
+		}
+	}
+
+	if f.Keys == nil && f.Regexp == nil {
+		return true
+	}
+
+	formatted := FormatKey(components, types)
+	if f.Keys != nil && !f.Keys[formatted] {
+		return false
+	}
+	if f.Regexp != nil && !f.Regexp.MatchString(formatted) {
+		return false
+	}
+
+	return true
+}
+
+// ReadKeysFile return the partition keys of a file, one per line with components separated by ':'.
+func ReadKeysFile(path string) (map[string]bool, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("open keys-file: %w", err)
+	}
+	defer file.Close()
+
+	keys := make(map[string]bool)
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		key := strings.TrimSpace(scanner.Text())
+		if key == "" || strings.HasPrefix(key, "#") {
+			continue
+		}
+		keys[key] = true
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("read keys-file: %w", err)
+	}
+
+	return keys, nil
+}
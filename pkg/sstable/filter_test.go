@@ -0,0 +1,81 @@
+package sstable
+
+import (
+	"encoding/binary"
+	"maps"
+	"math"
+	"os"
+	"path/filepath"
+	"regexp"
+	"testing"
+)
+
+func TestFilterMatch(t *testing.T) {
+	text := MarshalPrefix + "UTF8Type"
+	int32Type := MarshalPrefix + "Int32Type"
+	keys := func(keys ...string) map[string]bool {
+		m := make(map[string]bool)
+		for _, k := range keys {
+			m[k] = true
+		}
+		return m
+	}
+
+	tests := []struct {
+		name       string
+		filter     Filter
+		token      int64
+		components [][]byte
+		types      []string
+		match      bool
+	}{
+		{"no filter", Filter{}, 0, [][]byte{[]byte("a")}, []string{text}, true},
+		{"key listed", Filter{Keys: keys("a", "b")}, 0, [][]byte{[]byte("b")}, []string{text}, true},
+		{"key not listed", Filter{Keys: keys("a", "b")}, 0, [][]byte{[]byte("c")}, []string{text}, false},
+		{"empty key list", Filter{Keys: keys()}, 0, [][]byte{[]byte("a")}, []string{text}, false},
+		{"composite key listed", Filter{Keys: keys("a:42")}, 0, [][]byte{[]byte("a"), binary.BigEndian.AppendUint32(nil, 42)}, []string{text, int32Type}, true},
+		{"composite key of another component", Filter{Keys: keys("a:42")}, 0, [][]byte{[]byte("a"), binary.BigEndian.AppendUint32(nil, 43)}, []string{text, int32Type}, false},
+		{"blob key listed", Filter{Keys: keys("0xcafe")}, 0, [][]byte{{0xca, 0xfe}}, []string{MarshalPrefix + "BytesType"}, true},
+		{"regexp", Filter{Regexp: regexp.MustCompile("^user-[0-9]+$")}, 0, [][]byte{[]byte("user-12")}, []string{text}, true},
+		{"regexp not matching", Filter{Regexp: regexp.MustCompile("^user-[0-9]+$")}, 0, [][]byte{[]byte("user-x")}, []string{text}, false},
+		{"key and regexp", Filter{Keys: keys("user-1"), Regexp: regexp.MustCompile("^user-")}, 0, [][]byte{[]byte("user-1")}, []string{text}, true},
+		{"key but not regexp", Filter{Keys: keys("admin"), Regexp: regexp.MustCompile("^user-")}, 0, [][]byte{[]byte("admin")}, []string{text}, false},
+		{"regexp but not key", Filter{Keys: keys("user-1"), Regexp: regexp.MustCompile("^user-")}, 0, [][]byte{[]byte("user-2")}, []string{text}, false},
+		{"token in range", Filter{Tokens: true, Start: -10, End: 10}, 10, nil, nil, true},
+		{"token at range start", Filter{Tokens: true, Start: -10, End: 10}, -10, nil, nil, false},
+		{"token after range", Filter{Tokens: true, Start: -10, End: 10}, 11, nil, nil, false},
+		{"token in wrapping range", Filter{Tokens: true, Start: 10, End: -10}, math.MinInt64, nil, nil, true},
+		{"token out of wrapping range", Filter{Tokens: true, Start: 10, End: -10}, 0, nil, nil, false},
+		{"token in range not listed", Filter{Tokens: true, Start: -10, End: 10, Keys: keys("a")}, 0, [][]byte{[]byte("b")}, []string{text}, false},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if match := test.filter.Match(test.token, test.components, test.types); match != test.match {
+				t.Errorf("match %v, want %v", match, test.match)
+			}
+		})
+	}
+}
+
+func TestReadKeysFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "keys.txt")
+	err := os.WriteFile(path, []byte("# keys\na\n\n  b:1  \r\n#c\n"), 0600)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	keys, err := ReadKeysFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := map[string]bool{"a": true, "b:1": true}
+	if !maps.Equal(keys, want) {
+		t.Errorf("keys %v, want %v", keys, want)
+	}
+
+	_, err = ReadKeysFile(filepath.Join(t.TempDir(), "missing.txt"))
+	if err == nil {
+		t.Error("missing keys file read")
+	}
+}
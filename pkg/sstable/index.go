@@ -0,0 +1,63 @@
+package sstable
+
+import (
+	"bufio"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+)
+
+// IndexEntry is a partition of the Index.db file.
+type IndexEntry struct {
+	Key      []byte // serialized partition key
+	Position int64  // partition offset in uncompressed data
+}
+
+// ReadIndex return the partitions of an index file, in data order.
+func ReadIndex(path string) ([]IndexEntry, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("open index-file: %w", err)
+	}
+	defer file.Close()
+
+	var entries []IndexEntry
+	r := bufio.NewReader(file)
+	for {
+		// key with short length, position and promoted index size
+		var length [2]byte
+		_, err := io.ReadFull(r, length[:])
+		if errors.Is(err, io.EOF) {
+			return entries, nil
+		}
+		if err != nil {
+			return nil, fmt.Errorf("read index-file: %w", err)
+		}
+
+		entry := IndexEntry{Key: make([]byte, binary.BigEndian.Uint16(length[:]))}
+		_, err = io.ReadFull(r, entry.Key)
+		if err != nil {
+			return nil, fmt.Errorf("read index-file: %w", err)
+		}
+
+		position, err := ReadUvarint(r)
+		if err != nil {
+			return nil, fmt.Errorf("read index-file: %w", err)
+		}
+		entry.Position = int64(position)
+
+		// promoted index (clustering blocks of wide partitions) is skipped
+		size, err := ReadUvarint(r)
+		if err != nil {
+			return nil, fmt.Errorf("read index-file: %w", err)
+		}
+		_, err = r.Discard(int(size))
+		if err != nil {
+			return nil, fmt.Errorf("read index-file: %w", err)
+		}
+
+		entries = append(entries, entry)
+	}
+}
@@ -0,0 +1,325 @@
+package sstable
+
+import (
+	"bytes"
+	"container/heap"
+	"context"
+	"fmt"
+	"math"
+	"slices"
+	"strings"
+)
+
+// NewMerge return an sstable reading several sstables of a table together in token order,
+// each row being sent once, reconciled by timestamp with tombstones applied as in a compaction.
+// Its schema has all the columns of the sstables, with absolute timestamps and times.
+func NewMerge(ssts []*SSTable) (*SSTable, error) {
+	if len(ssts) == 0 {
+		return nil, fmt.Errorf("merge: no sstable")
+	}
+
+	first := &ssts[0].Schema
+	merged := New()
+	merged.DataFile = "merge"
+	merged.sources = ssts
+	merged.Schema = Schema{
+		Compound:     first.Compound,
+		PartitionKey: first.PartitionKey,
+		Clustering:   first.Clustering,
+	}
+
+	for _, sst := range ssts {
+		schema := &sst.Schema
+		if schema.Compound != first.Compound || !slices.Equal(schema.PartitionKey, first.PartitionKey) {
+			return nil, fmt.Errorf("merge %s: partition key %v differ from %v", sst.DataFile, schema.PartitionKey, first.PartitionKey)
+		}
+		if !slices.Equal(schema.Clustering, first.Clustering) {
+			return nil, fmt.Errorf("merge %s: clustering key %v differ from %v", sst.DataFile, schema.Clustering, first.Clustering)
+		}
+
+		for _, c := range schema.Columns {
+			i := merged.column(c.Name)
+			if i < 0 {
+				merged.Schema.Columns = append(merged.Schema.Columns, c)
+			} else if merged.Schema.Columns[i].Type != c.Type {
+				return nil, fmt.Errorf("merge %s: column %s type %s differ from %s", sst.DataFile, c.Name, c.Type, merged.Schema.Columns[i].Type)
+			}
+		}
+
+		merged.DataLength += sst.DataLength
+	}
+
+	// columns are ordered by name, as in sstables headers
+	slices.SortFunc(merged.Schema.Columns, func(a, b SchemaEntry) int { return strings.Compare(a.Name, b.Name) })
+
+	return merged, nil
+}
+
+// column return the index of a column of the schema, -1 if none.
+func (sst *SSTable) column(name string) int {
+	return slices.IndexFunc(sst.Schema.Columns, func(c SchemaEntry) bool { return c.Name == name })
+}
+
+// cursor is the next partition of a merged sstable.
+type cursor struct {
+	sst       *SSTable
+	reader    *bytes.Reader
+	partition Partition
+	columns   []int // merged column index of the sstable columns
+}
+
+// next read the next partition, false at the end of data.
+func (c *cursor) next() bool {
+	offset := c.reader.Size() - int64(c.reader.Len())
+	c.partition = Partition{}
+	err := c.partition.Read(c.reader, &c.sst.Schema)
+	if err != nil {
+		if offset < c.reader.Size() {
+			c.sst.Logger.Error("decode partition", "offset", offset, "error", err)
+		}
+		return false
+	}
+
+	for i := range c.partition.Rows {
+		rebase(&c.partition.Rows[i], &c.sst.Schema)
+	}
+	return true
+}
+
+// cursors is a heap of the sstables by their next partition.
+type cursors []*cursor
+
+func (h cursors) Len() int           { return len(h) }
+func (h cursors) Less(i, j int) bool { return h[i].partition.Less(&h[j].partition) }
+func (h cursors) Swap(i, j int)      { h[i], h[j] = h[j], h[i] }
+func (h *cursors) Push(x any)        { *h = append(*h, x.(*cursor)) }
+func (h *cursors) Pop() any {
+	old := *h
+	c := old[len(old)-1]
+	*h = old[:len(old)-1]
+	return c
+}
+
+// readMerged send the reconciled partitions of the merged sstables,
+// batches offsets are partitions numbers in the merge order.
+func (sst *SSTable) readMerged(ctx context.Context, bt *batcher) {
+	var all []*cursor
+	h := &cursors{}
+	for _, src := range sst.sources {
+		c := &cursor{sst: src, reader: bytes.NewReader(src.data)}
+		for _, col := range src.Schema.Columns {
+			c.columns = append(c.columns, sst.column(col.Name))
+		}
+		all = append(all, c)
+		if c.next() {
+			heap.Push(h, c)
+		}
+	}
+
+	var from, n int64
+	for h.Len() > 0 && ctx.Err() == nil {
+		// all the versions of the first partition
+		versions := []*cursor{heap.Pop(h).(*cursor)}
+		for h.Len() > 0 && (*h)[0].partition.Token == versions[0].partition.Token && bytes.Equal((*h)[0].partition.Key, versions[0].partition.Key) {
+			versions = append(versions, heap.Pop(h).(*cursor))
+		}
+
+		partition := sst.reconcile(versions)
+		n++
+
+		for _, c := range versions {
+			if c.next() {
+				heap.Push(h, c)
+			}
+		}
+
+		var position int64
+		for _, c := range all {
+			position += c.reader.Size() - int64(c.reader.Len())
+		}
+		sst.Position.Store(position)
+
+		if sst.Filter != nil && !sst.Filter.Match(partition.Token, partition.Components(), sst.Schema.PartitionKey) {
+			continue
+		}
+
+		batches := bt.batches(partition, Batch{Source: sst.DataFile, Offset: n - 1, From: from, End: n})
+		if len(batches) == 0 {
+			continue
+		}
+		if !bt.send(ctx, batches) {
+			return
+		}
+		from = n
+	}
+
+	// acknowledge the partitions after the last one sent
+	if ctx.Err() == nil && from < n {
+		bt.ch <- Batch{Source: sst.DataFile, Offset: from, From: from, End: n, Parts: 1}
+	}
+}
+
+// reconcile merge the versions of a partition: the most recent deletion applies,
+// each cell is the one of highest timestamp, a tombstone winning ties, then the greatest value.
+func (sst *SSTable) reconcile(versions []*cursor) *Partition {
+	first := &versions[0].partition
+	merged := &Partition{
+		HeaderKeyLength:         first.HeaderKeyLength,
+		HeaderKeys:              first.HeaderKeys,
+		HeaderLocalDeletiontime: first.HeaderLocalDeletiontime,
+		HeaderMarkedforDeleteAt: first.HeaderMarkedforDeleteAt,
+		Key:                     first.Key,
+		Token:                   first.Token,
+	}
+
+	// partition deletion, not deleted is the minimum timestamp
+	for _, c := range versions[1:] {
+		if int64(c.partition.HeaderMarkedforDeleteAt) > int64(merged.HeaderMarkedforDeleteAt) {
+			merged.HeaderMarkedforDeleteAt = c.partition.HeaderMarkedforDeleteAt
+			merged.HeaderLocalDeletiontime = c.partition.HeaderLocalDeletiontime
+		}
+	}
+	deletion := int64(merged.HeaderMarkedforDeleteAt)
+
+	// rows by clustering, in order of appearance
+	type version struct {
+		row     *Row
+		columns []int
+	}
+	var order []string
+	rows := make(map[string][]version)
+	for _, c := range versions {
+		for i := range c.partition.Rows {
+			r := &c.partition.Rows[i]
+			key := string(r.ClusteringValue)
+			if GetFlag(r.Flags, ExtensionFlag) {
+				key = "static"
+			}
+			if _, ok := rows[key]; !ok {
+				order = append(order, key)
+			}
+			rows[key] = append(rows[key], version{row: r, columns: c.columns})
+		}
+	}
+
+	for _, key := range order {
+		head := rows[key][0].row
+		row := Row{
+			Flags:            HasAllColumns | head.Flags&ExtensionFlag,
+			ExtentedFlags:    head.ExtentedFlags,
+			ClusteringHeader: head.ClusteringHeader,
+			ClusteringLength: head.ClusteringLength,
+			ClusteringValue:  head.ClusteringValue,
+			Cells:            make([]Cell, len(sst.Schema.Columns)),
+		}
+
+		// most recent deletion of the row or partition
+		rowDeletion := deletion
+		for _, v := range rows[key] {
+			if GetFlag(v.row.Flags, HasDeletion) {
+				rowDeletion = max(rowDeletion, int64(v.row.DeletionTimestamp))
+			}
+		}
+
+		// most recent primary key liveness not deleted
+		liveness := int64(math.MinInt64)
+		for _, v := range rows[key] {
+			if GetFlag(v.row.Flags, HasTimestamp) && int64(v.row.Timestamp) > rowDeletion && int64(v.row.Timestamp) > liveness {
+				liveness = int64(v.row.Timestamp)
+				row.Flags |= HasTimestamp
+				row.Timestamp = v.row.Timestamp
+				row.Flags &^= HasTTL
+				if GetFlag(v.row.Flags, HasTTL) {
+					row.Flags |= HasTTL
+					row.TTL = v.row.TTL
+					row.DeletionTime = v.row.DeletionTime
+				}
+			}
+		}
+
+		// most recent cells, absent if deleted
+		live := false
+		for i := range row.Cells {
+			var winner *Cell
+			for _, v := range rows[key] {
+				for j := range v.row.Cells {
+					if v.columns[j] == i && !v.row.Missing(j) && (winner == nil || newer(&v.row.Cells[j], winner)) {
+						winner = &v.row.Cells[j]
+					}
+				}
+			}
+			if winner == nil || GetFlag(winner.Flags, IsDeleted) || int64(winner.Timestamp) <= rowDeletion {
+				row.Cells[i] = Cell{TypeSize: sst.Schema.Columns[i].Size, Flags: HasEmptyValue}
+				if len(row.Cells) < 64 {
+					row.MissingColumns |= 1 << i
+				}
+				continue
+			}
+			row.Cells[i] = *winner
+			row.Cells[i].TypeSize = sst.Schema.Columns[i].Size
+			live = live || !GetFlag(winner.Flags, HasEmptyValue)
+		}
+
+		if row.MissingColumns != 0 {
+			row.Flags &^= HasAllColumns
+		}
+		if !GetFlag(row.Flags, HasTimestamp) && !live {
+			sst.Deleted.Add(1)
+			continue
+		}
+		merged.Rows = append(merged.Rows, row)
+	}
+
+	return merged
+}
+
+// newer return true if the cell a supersedes b.
+func newer(a, b *Cell) bool {
+	if a.Timestamp != b.Timestamp {
+		return int64(a.Timestamp) > int64(b.Timestamp)
+	}
+	if GetFlag(a.Flags, IsDeleted) != GetFlag(b.Flags, IsDeleted) {
+		return GetFlag(a.Flags, IsDeleted)
+	}
+	return bytes.Compare(a.Value, b.Value) > 0
+}
+
+// rebase make the row and cells timestamps and times absolute,
+// the cells sharing the row ones get their own.
+func rebase(row *Row, schema *Schema) {
+	if GetFlag(row.Flags, HasTimestamp) {
+		row.Timestamp = uint64(schema.MinTimestamp + int64(row.Timestamp))
+	}
+	if GetFlag(row.Flags, HasTTL) {
+		row.TTL = uint64(schema.MinTTL + int64(row.TTL))
+		row.DeletionTime = uint64(schema.MinLocalDeletionTime + int64(row.DeletionTime))
+	}
+	if GetFlag(row.Flags, HasDeletion) {
+		row.DeletionTimestamp = uint64(schema.MinTimestamp + int64(row.DeletionTimestamp))
+		row.LocalDeletionTime = uint64(schema.MinLocalDeletionTime + int64(row.LocalDeletionTime))
+	}
+
+	for i := range row.Cells {
+		c := &row.Cells[i]
+		if GetFlag(c.Flags, UseRowTimestamp) {
+			c.Timestamp = row.Timestamp
+			c.Flags &^= UseRowTimestamp
+		} else {
+			c.Timestamp = uint64(schema.MinTimestamp + int64(c.Timestamp))
+		}
+
+		if !GetFlag(c.Flags, IsDeleted) && !GetFlag(c.Flags, IsExpiring) {
+			continue
+		}
+		if GetFlag(c.Flags, UseRowTTL) {
+			c.TTL = row.TTL
+			c.LocalDeletionTime = row.DeletionTime
+			c.Flags &^= UseRowTTL
+		} else {
+			c.LocalDeletionTime = uint64(schema.MinLocalDeletionTime + int64(c.LocalDeletionTime))
+			if GetFlag(c.Flags, IsExpiring) {
+				c.TTL = uint64(schema.MinTTL + int64(c.TTL))
+			}
+		}
+	}
+}
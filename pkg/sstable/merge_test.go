@@ -0,0 +1,191 @@
+package sstable
+
+import (
+	"strings"
+	"testing"
+)
+
+// mergeVersion is a partition of a merged sstable, by columns names.
+type mergeVersion struct {
+	columns  []string
+	deletion int64 // partition deletion timestamp, 0 for none
+	rows     []Row
+}
+
+// mergeRow return a row of the clustering value, live at ts unless 0, of cells by sstable column, nil if missing.
+func mergeRow(ck string, ts int64, cells ...*Cell) Row {
+	row := Row{ClusteringValue: []byte(ck), Flags: HasAllColumns}
+	if ts != 0 {
+		row.Flags |= HasTimestamp
+		row.Timestamp = uint64(ts)
+	}
+	for i, c := range cells {
+		if c == nil {
+			row.Flags &^= HasAllColumns
+			row.MissingColumns |= 1 << i
+			c = &Cell{Flags: HasEmptyValue}
+		}
+		row.Cells = append(row.Cells, *c)
+	}
+	return row
+}
+
+// textCell return a cell of a text value written at ts.
+func textCell(ts int64, v string) *Cell {
+	return &Cell{TypeSize: TextSize, Timestamp: uint64(ts), Value: []byte(v)}
+}
+
+// deletedCell return a cell deleted at ts.
+func deletedCell(ts int64) *Cell {
+	return &Cell{Flags: IsDeleted, Timestamp: uint64(ts)}
+}
+
+// deletedRow return the row deleted at ts.
+func deletedRow(row Row, ts int64) Row {
+	row.Flags |= HasDeletion
+	row.DeletionTimestamp = uint64(ts)
+	return row
+}
+
+func TestReconcile(t *testing.T) {
+	tests := []struct {
+		name     string
+		columns  []string // merged columns
+		versions []mergeVersion
+		rows     []string // clustering:values of the reconciled rows, - for missing
+		deleted  int64
+	}{
+		{
+			name:    "newer cell",
+			columns: []string{"a", "b"},
+			versions: []mergeVersion{
+				{columns: []string{"a", "b"}, rows: []Row{mergeRow("k", 1, textCell(1, "old"), textCell(3, "new"))}},
+				{columns: []string{"a", "b"}, rows: []Row{mergeRow("k", 2, textCell(2, "new"), textCell(2, "old"))}},
+			},
+			rows: []string{"k:new,new"},
+		},
+		{
+			name:    "tombstone shadows older cell",
+			columns: []string{"a", "b"},
+			versions: []mergeVersion{
+				{columns: []string{"a", "b"}, rows: []Row{mergeRow("k", 1, textCell(1, "x"), textCell(1, "y"))}},
+				{columns: []string{"a", "b"}, rows: []Row{mergeRow("k", 0, deletedCell(2), nil)}},
+			},
+			rows: []string{"k:-,y"},
+		},
+		{
+			name:    "newer cell over tombstone",
+			columns: []string{"a"},
+			versions: []mergeVersion{
+				{columns: []string{"a"}, rows: []Row{mergeRow("k", 0, deletedCell(1))}},
+				{columns: []string{"a"}, rows: []Row{mergeRow("k", 0, textCell(2, "x"))}},
+			},
+			rows: []string{"k:x"},
+		},
+		{
+			name:    "row deletion shadows older row",
+			columns: []string{"a"},
+			versions: []mergeVersion{
+				{columns: []string{"a"}, rows: []Row{mergeRow("j", 1, textCell(1, "x")), mergeRow("k", 1, textCell(1, "x"))}},
+				{columns: []string{"a"}, rows: []Row{deletedRow(mergeRow("k", 0, nil), 2)}},
+			},
+			rows:    []string{"j:x"},
+			deleted: 1,
+		},
+		{
+			name:    "row deletion keeps newer cells",
+			columns: []string{"a", "b"},
+			versions: []mergeVersion{
+				{columns: []string{"a", "b"}, rows: []Row{mergeRow("k", 1, textCell(1, "x"), textCell(3, "y"))}},
+				{columns: []string{"a", "b"}, rows: []Row{deletedRow(mergeRow("k", 0, nil, nil), 2)}},
+			},
+			rows: []string{"k:-,y"},
+		},
+		{
+			name:    "partition deletion",
+			columns: []string{"a"},
+			versions: []mergeVersion{
+				{columns: []string{"a"}, rows: []Row{mergeRow("j", 1, textCell(1, "x")), mergeRow("k", 3, textCell(3, "y"))}},
+				{columns: []string{"a"}, deletion: 2},
+			},
+			rows:    []string{"k:y"},
+			deleted: 1,
+		},
+		{
+			name:    "tie on value",
+			columns: []string{"a"},
+			versions: []mergeVersion{
+				{columns: []string{"a"}, rows: []Row{mergeRow("k", 1, textCell(1, "y"))}},
+				{columns: []string{"a"}, rows: []Row{mergeRow("k", 1, textCell(1, "x"))}},
+			},
+			rows: []string{"k:y"},
+		},
+		{
+			name:    "tie of tombstone",
+			columns: []string{"a", "b"},
+			versions: []mergeVersion{
+				{columns: []string{"a", "b"}, rows: []Row{mergeRow("k", 1, textCell(1, "x"), textCell(1, "y"))}},
+				{columns: []string{"a", "b"}, rows: []Row{mergeRow("k", 0, deletedCell(1), nil)}},
+			},
+			rows: []string{"k:-,y"},
+		},
+		{
+			name:    "row deletion tie",
+			columns: []string{"a"},
+			versions: []mergeVersion{
+				{columns: []string{"a"}, rows: []Row{mergeRow("k", 1, textCell(1, "x"))}},
+				{columns: []string{"a"}, rows: []Row{deletedRow(mergeRow("k", 0, nil), 1)}},
+			},
+			deleted: 1,
+		},
+		{
+			name:    "different columns",
+			columns: []string{"a", "b", "c"},
+			versions: []mergeVersion{
+				{columns: []string{"a", "b"}, rows: []Row{mergeRow("j", 1, textCell(1, "a1"), textCell(1, "b1")), mergeRow("k", 1, textCell(1, "a1"), textCell(1, "b1"))}},
+				{columns: []string{"b", "c"}, rows: []Row{mergeRow("k", 2, textCell(2, "b2"), textCell(2, "c2")), mergeRow("l", 2, nil, textCell(2, "c2"))}},
+			},
+			rows: []string{"j:a1,b1,-", "k:a1,b2,c2", "l:-,-,c2"},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			merged := New()
+			for _, name := range test.columns {
+				merged.Schema.Columns = append(merged.Schema.Columns, SchemaEntry{Name: name, Type: MarshalPrefix + "UTF8Type", Size: TextSize})
+			}
+			var versions []*cursor
+			for _, v := range test.versions {
+				c := &cursor{partition: Partition{Key: []byte("p"), HeaderMarkedforDeleteAt: LiveMarkedForDeleteAt, Rows: v.rows}}
+				if v.deletion != 0 {
+					c.partition.HeaderMarkedforDeleteAt = uint64(v.deletion)
+				}
+				for _, name := range v.columns {
+					c.columns = append(c.columns, merged.column(name))
+				}
+				versions = append(versions, c)
+			}
+
+			p := merged.reconcile(versions)
+			var rows []string
+			for _, r := range p.Rows {
+				var values []string
+				for i, c := range r.Cells {
+					if r.Missing(i) {
+						values = append(values, "-")
+					} else {
+						values = append(values, string(c.Value))
+					}
+				}
+				rows = append(rows, string(r.ClusteringValue)+":"+strings.Join(values, ","))
+			}
+			if strings.Join(rows, " ") != strings.Join(test.rows, " ") {
+				t.Errorf("rows %v, want %v", rows, test.rows)
+			}
+			if merged.Deleted.Load() != test.deleted {
+				t.Errorf("%d rows deleted, want %d", merged.Deleted.Load(), test.deleted)
+			}
+		})
+	}
+}
@@ -0,0 +1,104 @@
+package sstable
+
+import (
+	"encoding/binary"
+	"math"
+	"math/bits"
+)
+
+const (
+	murmurC1 uint64 = 0x87c37b91114253d5
+	murmurC2 uint64 = 0x4cf5ad432745937f
+)
+
+// Murmur3 return the 128 bits MurmurHash3_x64 (seed 0) of data as computed by Cassandra,
+// which sign extends the tail bytes.
+func Murmur3(data []byte) (uint64, uint64) {
+	var h1, h2 uint64
+
+	// body
+	n := len(data) / 16
+	for i := 0; i < n; i++ {
+		k1 := binary.LittleEndian.Uint64(data[i*16:])
+		k2 := binary.LittleEndian.Uint64(data[i*16+8:])
+
+		k1 *= murmurC1
+		k1 = bits.RotateLeft64(k1, 31)
+		k1 *= murmurC2
+		h1 ^= k1
+
+		h1 = bits.RotateLeft64(h1, 27)
+		h1 += h2
+		h1 = h1*5 + 0x52dce729
+
+		k2 *= murmurC2
+		k2 = bits.RotateLeft64(k2, 33)
+		k2 *= murmurC1
+		h2 ^= k2
+
+		h2 = bits.RotateLeft64(h2, 31)
+		h2 += h1
+		h2 = h2*5 + 0x38495ab5
+	}
+
+	// tail, bytes are signed in java
+	tail := data[n*16:]
+	var k1, k2 uint64
+	for i := len(tail) - 1; i >= 8; i-- {
+		k2 ^= uint64(int64(int8(tail[i]))) << ((i - 8) * 8)
+	}
+	if len(tail) > 8 {
+		k2 *= murmurC2
+		k2 = bits.RotateLeft64(k2, 33)
+		k2 *= murmurC1
+		h2 ^= k2
+	}
+	for i := min(len(tail), 8) - 1; i >= 0; i-- {
+		k1 ^= uint64(int64(int8(tail[i]))) << (i * 8)
+	}
+	if len(tail) > 0 {
+		k1 *= murmurC1
+		k1 = bits.RotateLeft64(k1, 31)
+		k1 *= murmurC2
+		h1 ^= k1
+	}
+
+	// finalization
+	h1 ^= uint64(len(data))
+	h2 ^= uint64(len(data))
+
+	h1 += h2
+	h2 += h1
+
+	h1 = fmix64(h1)
+	h2 = fmix64(h2)
+
+	h1 += h2
+	h2 += h1
+
+	return h1, h2
+}
+
+func fmix64(k uint64) uint64 {
+	k ^= k >> 33
+	k *= 0xff51afd7ed558ccd
+	k ^= k >> 33
+	k *= 0xc4ceb9fe1a85ec53
+	k ^= k >> 33
+	return k
+}
+
+// Token return the Murmur3Partitioner token of a serialized partition key.
+func Token(key []byte) int64 {
+	h1, _ := Murmur3(key)
+	return hashToken(h1)
+}
+
+// hashToken return the token of a key hash, the minimum token is reserved.
+func hashToken(h1 uint64) int64 {
+	token := int64(h1)
+	if token == math.MinInt64 {
+		return math.MaxInt64
+	}
+	return token
+}
@@ -0,0 +1,84 @@
+package sstable
+
+import (
+	"bytes"
+	"encoding/binary"
+	"encoding/hex"
+	"math"
+	"strconv"
+	"testing"
+)
+
+func TestMurmur3(t *testing.T) {
+	// h1 of "", "0", "01"... generated by the java datastax driver, covering all the tail lengths
+	series := []uint64{
+		0x0000000000000000,
+		0x2ac9debed546a380,
+		0x649e4eaa7fc1708e,
+		0xce68f60d7c353bdb,
+		0x0f95757ce7f38254,
+		0x0f04e459497f3fc1,
+		0x88c0a92586be0a27,
+		0x13eb9fb82606f7a6,
+		0x8236039b7387354d,
+		0x4c1e87519fe738ba,
+		0x3f9652ac3effeb24,
+		0x3f33760ded9006c6,
+		0xaed70a6631854cb1,
+		0x8a299a8f8e0e2da7,
+		0x624b675c779249a6,
+		0xa4b203bb1d90b9a3,
+		0xa3293ad698ecb99a,
+		0xbc740023dbd50048,
+		0x3fe5ab9837d25cdd,
+		0x2d0338c1ca87d132,
+	}
+	key := ""
+	for i, want := range series {
+		if h1, _ := Murmur3([]byte(key)); h1 != want {
+			t.Errorf("murmur3 of %q: %x, want %x", key, h1, want)
+		}
+		key += strconv.Itoa(i % 10)
+	}
+
+	// vectors of other drivers
+	for key, want := range map[string]uint64{
+		"hello":                     0xcbd8a7b341bd9b02,
+		"hello, world":              0x342fac623a5ebc8e,
+		"19 Jan 2038 at 3:14:07 AM": 0xb89e5988b737affc,
+		"The quick brown fox jumps over the lazy dog.": 0xcd99481f9ee902c9,
+	} {
+		if h1, _ := Murmur3([]byte(key)); h1 != want {
+			t.Errorf("murmur3 of %q: %x, want %x", key, h1, want)
+		}
+	}
+}
+
+func TestToken(t *testing.T) {
+	// select token(1) of an int partition key
+	if token := Token(binary.BigEndian.AppendUint32(nil, 1)); token != -4069959284402364209 {
+		t.Errorf("token of int 1: %d, want -4069959284402364209", token)
+	}
+
+	// composite key (uuid, int) of tail bytes with the sign bit set
+	uuid, _ := hex.DecodeString("4327529fb645dd00b883ec39ae448bb8")
+	key := JoinKey([][]byte{uuid, binary.BigEndian.AppendUint32(nil, 0x066a6b)}, true)
+	if hex.EncodeToString(key) != "00104327529fb645dd00b883ec39ae448bb800000400066a6b00" {
+		t.Errorf("composite key %x", key)
+	}
+	if token := Token(key); token != -9223371632693506265 {
+		t.Errorf("token of composite key: %d, want -9223371632693506265", token)
+	}
+	components, err := SplitKey(key, true)
+	if err != nil || len(components) != 2 || !bytes.Equal(components[0], uuid) {
+		t.Errorf("split composite key: %x %v", components, err)
+	}
+
+	// the minimum token is reserved for the ring start
+	if token := hashToken(1 << 63); token != math.MaxInt64 {
+		t.Errorf("token of the minimum hash: %d, want %d", token, int64(math.MaxInt64))
+	}
+	if token := hashToken(1<<63 + 1); token != math.MinInt64+1 {
+		t.Errorf("token of the minimum hash + 1: %d, want %d", token, int64(math.MinInt64+1))
+	}
+}
@@ -1,12 +1,25 @@
 package sstable
 
-import "io"
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"io"
+)
+
+// deletion of a live partition
+const (
+	LiveLocalDeletionTime uint32 = 0x7fffffff
+	LiveMarkedForDeleteAt uint64 = 0x8000000000000000
+)
 
 type Partition struct {
 	HeaderKeyLength         uint16      // uint16
 	HeaderKeys              []HeaderKey // HeaderKeyLength size, compound key separated by 00
 	HeaderLocalDeletiontime uint32      // uint32
 	HeaderMarkedforDeleteAt uint64      // uint64
+	Key                     []byte      // serialized key, as hashed for the token
+	Token                   int64       // Murmur3Partitioner token of the key
 	Rows                    []Row
 }
 
@@ -14,8 +27,17 @@ type HeaderKey struct {
 	Value []byte // Length size
 }
 
-func (partition *Partition) Read(r io.Reader, compoundPK bool) (err error) {
-	if compoundPK {
+func (partition *Partition) Read(r io.Reader, schema *Schema) error {
+	err := partition.ReadHeader(r, schema)
+	if err != nil {
+		return err
+	}
+	return partition.ReadRows(r, schema)
+}
+
+// ReadHeader read the partition key and deletion.
+func (partition *Partition) ReadHeader(r io.Reader, schema *Schema) (err error) {
+	if schema.Compound {
 		// header key length
 		partition.HeaderKeyLength, err = ReadUint16(r)
 		if err != nil {
@@ -45,6 +67,8 @@ func (partition *Partition) Read(r io.Reader, compoundPK bool) (err error) {
 		}
 		partition.HeaderKeys = append(partition.HeaderKeys, hk)
 	}
+	partition.Key = JoinKey(partition.Components(), schema.Compound)
+	partition.Token = Token(partition.Key)
 
 	// header local deletion time
 	partition.HeaderLocalDeletiontime, err = ReadUint32(r)
@@ -58,9 +82,45 @@ func (partition *Partition) Read(r io.Reader, compoundPK bool) (err error) {
 		return err
 	}
 
+	return nil
+}
+
+// Append serialize the partition at the end of b, its key being the serialized Key if set.
+func (partition *Partition) Append(b []byte, schema *Schema) ([]byte, error) {
+	key := partition.Key
+	if key == nil {
+		key = JoinKey(partition.Components(), schema.Compound)
+	}
+	if len(key) > 0xffff {
+		return b, fmt.Errorf("partition key of %d bytes: too long", len(key))
+	}
+
+	start := len(b)
+	b = binary.BigEndian.AppendUint16(b, uint16(len(key)))
+	b = append(b, key...)
+	b = binary.BigEndian.AppendUint32(b, partition.HeaderLocalDeletiontime)
+	b = binary.BigEndian.AppendUint64(b, partition.HeaderMarkedforDeleteAt)
+
+	// each row has the size of the previous one
+	var err error
+	previous := len(b) - start
+	for i := range partition.Rows {
+		row := len(b)
+		b, err = partition.Rows[i].Append(b, schema, previous)
+		if err != nil {
+			return b, err
+		}
+		previous = len(b) - row
+	}
+
+	return append(b, EndOfPartition), nil
+}
+
+// ReadRows read the rows until the end of the partition.
+func (partition *Partition) ReadRows(r io.Reader, schema *Schema) (err error) {
 	for {
 		row := Row{}
-		err = row.Read(r)
+		err = row.Read(r, schema)
 		if err != nil {
 			return err
 		}
@@ -107,3 +167,57 @@ func (hk *HeaderKey) ReadCompound(r io.Reader) (int, error) {
 
 	return int(length) + 3, nil
 }
+
+// Components return the partition key components values.
+func (partition *Partition) Components() [][]byte {
+	components := make([][]byte, len(partition.HeaderKeys))
+	for i, hk := range partition.HeaderKeys {
+		components[i] = hk.Value
+	}
+	return components
+}
+
+// JoinKey serialize key components, a compound key is a composite of
+// the components each with its length and an end of component byte.
+func JoinKey(components [][]byte, compound bool) []byte {
+	if !compound {
+		return components[0]
+	}
+
+	var key []byte
+	for _, c := range components {
+		key = binary.BigEndian.AppendUint16(key, uint16(len(c)))
+		key = append(key, c...)
+		key = append(key, 0)
+	}
+	return key
+}
+
+// SplitKey return the components of a serialized key.
+func SplitKey(key []byte, compound bool) ([][]byte, error) {
+	if !compound {
+		return [][]byte{key}, nil
+	}
+
+	var components [][]byte
+	for len(key) > 0 {
+		if len(key) < 3 {
+			return nil, io.ErrUnexpectedEOF
+		}
+		length := int(binary.BigEndian.Uint16(key))
+		if len(key) < 3+length {
+			return nil, io.ErrUnexpectedEOF
+		}
+		components = append(components, key[2:2+length])
+		key = key[3+length:]
+	}
+	return components, nil
+}
+
+// Less return true if the partition is before other in the sstable order, by token then key bytes.
+func (partition *Partition) Less(other *Partition) bool {
+	if partition.Token != other.Token {
+		return partition.Token < other.Token
+	}
+	return bytes.Compare(partition.Key, other.Key) < 0
+}
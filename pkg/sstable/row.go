@@ -1,6 +1,9 @@
 package sstable
 
-import "io"
+import (
+	"fmt"
+	"io"
+)
 
 const (
 	EndOfPartition     byte = 0x01
@@ -23,14 +26,14 @@ type Row struct {
 	PreviousSize      uint64 // uvarint
 	Timestamp         uint64 // optional uvarint
 	TTL               uint64 // optional uvarint
-	DeletionTime      uint64 // optional uvarint
-	DeletionTimestamp uint64 // optional uvarint
+	DeletionTime      uint64 // optional uvarint, local expiration time
+	DeletionTimestamp uint64 // optional uvarint, marked for delete at
 	LocalDeletionTime uint64 // optional uvarint
 	MissingColumns    uint64 // optional uvarint
 	Cells             []Cell // optional length determined by schema
 }
 
-func (row *Row) Read(r io.Reader) (err error) {
+func (row *Row) Read(r io.Reader, schema *Schema) (err error) {
 	// flags
 	row.Flags, err = ReadOne(r)
 	if err != nil {
@@ -50,21 +53,28 @@ func (row *Row) Read(r io.Reader) (err error) {
 		return nil
 	}
 
-	// clusteringBlock if we have not static row FIXME: need to really check extented flag
-	if !GetFlag(row.Flags, ExtensionFlag) {
+	// clusteringBlock if we have not static row, and only for tables with a clustering key
+	// FIXME: need to really check extented flag
+	if !GetFlag(row.Flags, ExtensionFlag) && len(schema.Clustering) > 0 {
 		row.ClusteringHeader, err = ReadUvarint(r)
 		if err != nil {
 			return err
 		}
 
-		row.ClusteringLength, err = ReadUvarint(r)
-		if err != nil {
-			return err
-		}
-
-		row.ClusteringValue, err = ReadSome(r, int(row.ClusteringLength))
-		if err != nil {
-			return err
+		// empty or null values have no length nor value, fixed size ones no length
+		if row.ClusteringHeader&3 == 0 {
+			row.ClusteringLength = GetTypeSize(schema.Clustering[0])
+			if row.ClusteringLength == TextSize {
+				row.ClusteringLength, err = ReadUvarint(r)
+				if err != nil {
+					return err
+				}
+			}
+
+			row.ClusteringValue, err = ReadSome(r, int(row.ClusteringLength))
+			if err != nil {
+				return err
+			}
 		}
 	}
 
@@ -96,51 +106,51 @@ func (row *Row) Read(r io.Reader) (err error) {
 		}
 	}
 
-	// deletionTime if row is deleted or expiring
-	if GetFlag(row.Flags, HasDeletion) || GetFlag(row.Flags, HasTTL) {
+	// local expiration time if row is expiring
+	if GetFlag(row.Flags, HasTTL) {
 		row.DeletionTime, err = ReadUvarint(r)
 		if err != nil {
 			return err
 		}
 	}
 
-	// deletionTimeStamp if row is deleted
+	// deletion timestamp and local deletion time if row is deleted
 	if GetFlag(row.Flags, HasDeletion) {
 		row.DeletionTimestamp, err = ReadUvarint(r)
 		if err != nil {
 			return err
 		}
-	}
 
-	// localDeletionTime if row is deleted
-	if GetFlag(row.Flags, HasDeletion) {
 		row.LocalDeletionTime, err = ReadUvarint(r)
 		if err != nil {
 			return err
 		}
 	}
 
-	// missing columns if we don't have all columns
+	// missing columns if we don't have all columns, as a bitmap of the schema columns
 	if !GetFlag(row.Flags, HasAllColumns) {
+		if len(schema.Columns) >= 64 {
+			return fmt.Errorf("missing columns of %d columns: not supported", len(schema.Columns))
+		}
 		row.MissingColumns, err = ReadUvarint(r)
 		if err != nil {
 			return err
 		}
 	}
 
-	// if we have all columns get the numbers of cell from schema
-	// otherwise determine it from MissingColumns field TODO
-	if !GetFlag(row.Flags, HasAllColumns) {
-		return nil
-	}
-
 	// cells
-	row.Cells = make([]Cell, len(Schema))
+	row.Cells = make([]Cell, len(schema.Columns))
 
-	// read number of cells according to the schema
-	for i := 0; i < len(Schema); i++ {
+	// read number of cells according to the schema, missing ones are left empty
+	for i := 0; i < len(schema.Columns); i++ {
 		cell := Cell{
-			TypeSize: Schema[i].Size,
+			TypeSize: schema.Columns[i].Size,
+		}
+
+		if row.Missing(i) {
+			cell.Flags = HasEmptyValue
+			row.Cells[i] = cell
+			continue
 		}
 
 		err = cell.Read(r)
@@ -153,3 +163,71 @@ func (row *Row) Read(r io.Reader) (err error) {
 
 	return nil
 }
+
+// Missing return true if the row has no cell for the column i.
+func (row *Row) Missing(i int) bool {
+	return !GetFlag(row.Flags, HasAllColumns) && row.MissingColumns&(1<<i) != 0
+}
+
+// Append serialize the row at the end of b, previous is the size of the previous row,
+// or of the partition header for the first one. Body and previous sizes are computed.
+func (row *Row) Append(b []byte, schema *Schema, previous int) ([]byte, error) {
+	if GetFlag(row.Flags, ExtensionFlag) {
+		return b, fmt.Errorf("static row: not supported")
+	}
+	if len(row.Cells) != len(schema.Columns) {
+		return b, fmt.Errorf("row of %d cells for %d columns", len(row.Cells), len(schema.Columns))
+	}
+
+	b = append(b, row.Flags)
+
+	// clustering block, one header for up to 32 values with 2 bits by value, set when empty
+	switch len(schema.Clustering) {
+	case 0:
+	case 1:
+		if len(row.ClusteringValue) == 0 {
+			b = AppendUvarint(b, 1)
+			break
+		}
+		b = AppendUvarint(b, 0)
+		if GetTypeSize(schema.Clustering[0]) == TextSize {
+			b = AppendUvarint(b, uint64(len(row.ClusteringValue)))
+		}
+		b = append(b, row.ClusteringValue...)
+	default:
+		return b, fmt.Errorf("%d clustering columns: not supported", len(schema.Clustering))
+	}
+
+	// body: liveness, deletion, columns and cells
+	var body []byte
+	if GetFlag(row.Flags, HasTimestamp) {
+		body = AppendUvarint(body, row.Timestamp)
+	}
+	if GetFlag(row.Flags, HasTTL) {
+		body = AppendUvarint(body, row.TTL)
+		body = AppendUvarint(body, row.DeletionTime)
+	}
+	if GetFlag(row.Flags, HasDeletion) {
+		body = AppendUvarint(body, row.DeletionTimestamp)
+		body = AppendUvarint(body, row.LocalDeletionTime)
+	}
+	if !GetFlag(row.Flags, HasAllColumns) {
+		if len(schema.Columns) >= 64 {
+			return b, fmt.Errorf("missing columns of %d columns: not supported", len(schema.Columns))
+		}
+		body = AppendUvarint(body, row.MissingColumns)
+	}
+	for i := range row.Cells {
+		if row.Missing(i) {
+			continue
+		}
+		cell := row.Cells[i]
+		cell.TypeSize = schema.Columns[i].Size
+		body = cell.Append(body)
+	}
+
+	// the body size counts the previous size
+	b = AppendUvarint(b, uint64(len(body)+UvarintSize(uint64(previous))))
+	b = AppendUvarint(b, uint64(previous))
+	return append(b, body...), nil
+}
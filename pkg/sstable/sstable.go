@@ -2,9 +2,14 @@ package sstable
 
 import (
 	"bytes"
+	"context"
 	"encoding/binary"
 	"fmt"
+	"io"
+	"log/slog"
 	"os"
+	"sync/atomic"
+	"time"
 
 	"github.com/ghostiam/binstruct"
 	"github.com/gocql/gocql"
@@ -12,33 +17,79 @@ import (
 	"go.uber.org/ratelimit"
 )
 
-var Schema []SchemaEntry
-
 const (
 	TextSize   uint64 = 0
 	Int32Size  uint64 = 4
 	DoubleSize uint64 = 8
 )
 
+type Schema struct {
+	MinTimestamp         int64 // microseconds, base of rows and cells timestamps
+	MinLocalDeletionTime int64 // seconds, base of rows and cells local deletion times
+	MinTTL               int64 // seconds, base of rows and cells ttls
+	Compound             bool
+	PartitionKey         []string // partition key component types
+	Clustering           []string // clustering key types
+	Columns              []SchemaEntry
+}
+
 type SchemaEntry struct {
 	Name string
+	Type string
 	Size uint64
 }
 
+// Batch is a group of rows from the same partition.
+// A partition is fully loaded when its Parts batches are, all data in [From, End) is then loaded.
+type Batch struct {
+	Source string // data file
+	Key    string // partition key, components separated by ':'
+	Offset int64  // partition offset in uncompressed data
+	From   int64  // end of the previous partition sent
+	End    int64  // end of the partition
+	Parts  int    // number of batches of the partition
+	Bytes  int    // values size of the rows
+	Rows   [][]any
+}
+
+// BytesLimiter limit the values bytes sent per second.
+type BytesLimiter interface {
+	TakeN(n int) time.Time
+}
+
 type SSTable struct {
 	DataFile        string
 	StatisticsFile  string
 	CompressionFile string
-	Debug           bool
-	Compound        bool
+	IndexFile       string  // to seek to filtered partitions, if any
+	Filter          *Filter // partitions to read, all if nil
+	Logger          *slog.Logger
+	Schema          Schema
 	Sampling        int
 	Limit           int
-	Queries         int
+	WriteTime       *Window // rows and cells written in the window only, all if nil
+	Stats           StatsMetadata
+	OutOfWindow     atomic.Int64      // rows skipped outside the write time window
+	KeepExpired     bool              // load rows and cells whose ttl elapsed
+	ExpiredRows     atomic.Int64      // rows skipped as expired
+	ExpiredCells    atomic.Int64      // cells unset as expired
+	Deleted         atomic.Int64      // rows removed by tombstones when merging
+	Limiter         ratelimit.Limiter // instead of a Limit rows/s limiter, if any
+	BytesLimiter    BytesLimiter      // values bytes limiter, if any
+	BatchSize       int               // max rows per batch
+	BatchBytes      int               // max values bytes per batch
+	Queries         atomic.Int64      // rows decoded and sent
+	Decompressed    atomic.Int64      // data bytes decompressed
+	Start           int64             // partition offset to start reading from
+	Position        atomic.Int64      // end of the last partition read
+	DataLength      int64             // uncompressed data length
+	cinfo           *CompressionInfo
+	sources         []*SSTable // merged sstables, if any
 	data            []byte
 }
 
 func New() *SSTable {
-	return &SSTable{}
+	return &SSTable{Logger: slog.Default()}
 }
 
 func (sst *SSTable) ReadStatistics() error {
@@ -58,37 +109,46 @@ func (sst *SSTable) ReadStatistics() error {
 	file.Close()
 
 	// display some structure info
-	if sst.Debug {
-		fmt.Printf("(debug) partition-key %v\n", stats.Serialization.PartitionKeyTypeValue)
+	if sst.Logger.Enabled(context.Background(), slog.LevelDebug) {
+		sst.Logger.Debug("partition key", "type", stats.Serialization.PartitionKeyTypeValue)
 
 		for _, t := range stats.Serialization.ClusteringKey {
-			fmt.Printf("(debug) clustering-key %s\n", t.Type)
+			sst.Logger.Debug("clustering key", "type", t.Type)
 		}
 		for i, t := range stats.Serialization.RegularColumns {
-			fmt.Printf("(debug) columns[%d] %s(%s)\n", i, t.Name, t.Type)
+			sst.Logger.Debug("column", "index", i, "name", t.Name, "type", t.Type)
 		}
+		sst.Logger.Debug("timestamps", "min", stats.Stats.MinTimestamp, "max", stats.Stats.MaxTimestamp)
 	}
 
 	// fill schema infos from stats file
-	Schema = make([]SchemaEntry, stats.Serialization.RegularColumnsNumber)
+	sst.Stats = stats.Stats
+	sst.Schema.MinTimestamp = int64(stats.Serialization.MinTimestamp) + TimestampEpoch
+	sst.Schema.MinLocalDeletionTime = int64(stats.Serialization.MinLocalDeletionTIme) + LocalDeletionTimeEpoch
+	sst.Schema.MinTTL = int64(stats.Serialization.MinTTL)
+
+	// a compound partition key is serialized as a CompositeType of its components
+	sst.Schema.PartitionKey, sst.Schema.Compound = ParseCompositeType(stats.Serialization.PartitionKeyTypeValue)
+
+	sst.Schema.Clustering = make([]string, stats.Serialization.ClusteringKeyNumber)
+	for i, t := range stats.Serialization.ClusteringKey {
+		sst.Schema.Clustering[i] = t.Type
+	}
+
+	sst.Schema.Columns = make([]SchemaEntry, stats.Serialization.RegularColumnsNumber)
 	for i := 0; i < int(stats.Serialization.RegularColumnsNumber); i++ {
-		Schema[i].Name = stats.Serialization.RegularColumns[i].Name
-		Schema[i].Size = stats.Serialization.RegularColumns[i].TypeSize
+		sst.Schema.Columns[i].Name = stats.Serialization.RegularColumns[i].Name
+		sst.Schema.Columns[i].Type = stats.Serialization.RegularColumns[i].Type
+		sst.Schema.Columns[i].Size = stats.Serialization.RegularColumns[i].TypeSize
 	}
 
 	return nil
 }
 
-func (sst *SSTable) ReadData() error {
-	// data file
-	dataf, err := os.Open(sst.DataFile)
-	if err != nil {
-		return fmt.Errorf("open data-file: %w", err)
-	}
-	defer dataf.Close()
-
-	// get file size
-	datafi, err := dataf.Stat()
+// ReadCompressionInfo read the data chunks layout and the uncompressed data length.
+func (sst *SSTable) ReadCompressionInfo() error {
+	// get data file size
+	datafi, err := os.Stat(sst.DataFile)
 	if err != nil {
 		return fmt.Errorf("stat data-file: %w", err)
 	}
@@ -98,6 +158,7 @@ func (sst *SSTable) ReadData() error {
 	if err != nil {
 		return fmt.Errorf("open compression-file: %w", err)
 	}
+	defer compf.Close()
 
 	// decode compression info to struct
 	cinfo := CompressionInfo{}
@@ -107,13 +168,45 @@ func (sst *SSTable) ReadData() error {
 	if err != nil {
 		return fmt.Errorf("decode compression-file: %w", err)
 	}
-	compf.Close()
 
-	if sst.Debug {
-		fmt.Printf("(debug) compressor-name: %s\n", cinfo.CompressorName.Value)
+	sst.Logger.Debug("compression", "compressor", cinfo.CompressorName.Value, "length", cinfo.DataLength)
+
+	sst.cinfo = &cinfo
+	sst.DataLength = cinfo.DataLength
+
+	return nil
+}
+
+func (sst *SSTable) ReadData() error {
+	// merged sstables data
+	if sst.sources != nil {
+		for _, src := range sst.sources {
+			err := src.ReadData()
+			if err != nil {
+				return fmt.Errorf("merge %s: %w", src.DataFile, err)
+			}
+			sst.Decompressed.Add(src.Decompressed.Load())
+		}
+		return nil
 	}
 
+	if sst.cinfo == nil {
+		err := sst.ReadCompressionInfo()
+		if err != nil {
+			return err
+		}
+	}
+	cinfo := sst.cinfo
+
+	// data file
+	dataf, err := os.Open(sst.DataFile)
+	if err != nil {
+		return fmt.Errorf("open data-file: %w", err)
+	}
+	defer dataf.Close()
+
 	// uncompress data chunk by chunk
+	sst.data = make([]byte, 0, cinfo.DataLength)
 	for i := 0; i < int(cinfo.ChunkCount); i++ {
 		chunk := DataChunk{}
 		chunk.CompressedLength = cinfo.ChunkSizes[i]
@@ -130,65 +223,277 @@ func (sst *SSTable) ReadData() error {
 		}
 
 		sst.data = append(sst.data, uncompressedBytes...)
+		sst.Decompressed.Add(int64(len(uncompressedBytes)))
 	}
 
 	return nil
 }
 
-func (sst *SSTable) ReadPartitions(ch chan []any) {
-	rl := ratelimit.New(sst.Limit)
+// Close release the uncompressed data.
+func (sst *SSTable) Close() {
+	sst.data = nil
+	for _, src := range sst.sources {
+		src.Close()
+	}
+}
+
+// ReadPartitions send rows to the channel until the end of data or ctx is done.
+func (sst *SSTable) ReadPartitions(ctx context.Context, ch chan Batch) {
+	bt := sst.batcher(ctx, ch)
+
+	// merged sstables are read together
+	if sst.sources != nil {
+		sst.readMerged(ctx, bt)
+		return
+	}
+
 	reader := bytes.NewReader(sst.data)
 
+	// resume from a partition boundary
+	from, _ := reader.Seek(sst.Start, io.SeekStart)
+	sst.Position.Store(from)
+
+	// filtered partitions are looked up in the index when possible, then read directly
+	positions, seek := sst.selected()
+
+	// partitions are sorted by token then key, otherwise keys are not decoded as written
+	var (
+		last      *Partition
+		unordered int
+	)
+	defer func() {
+		if unordered > 0 {
+			sst.Logger.Error("partitions out of token order, check the partition key type", "unordered", unordered)
+		}
+	}()
+
 	// loop over partition
-	for {
+	for ctx.Err() == nil {
+		// jump to the next selected partition, or to the end once all are read
+		if seek {
+			if len(positions) > 0 {
+				reader.Seek(positions[0], io.SeekStart)
+				positions = positions[1:]
+			} else {
+				reader.Seek(0, io.SeekEnd)
+			}
+		}
+
+		offset := reader.Size() - int64(reader.Len())
 		partition := Partition{}
-		err := partition.Read(reader, sst.Compound)
-		if err != nil {
-			break // we should have reach eof
-		}
-
-		var pvalues []any
-
-		for _, hk := range partition.HeaderKeys {
-			pvalues = append(pvalues, hk.Value)
-		}
-
-		for _, r := range partition.Rows {
-			var values []any
-			values = append(pvalues, r.ClusteringValue)
-
-			for _, c := range r.Cells {
-				// Internal type
-				switch c.TypeSize {
-				case TextSize:
-					if string(c.Value) == "" {
-						values = append(values, &gocql.UnsetValue)
-					} else {
-						values = append(values, string(c.Value))
-					}
-				case Int32Size:
-					if GetFlag(c.Flags, HasEmptyValue) {
-						values = append(values, &gocql.UnsetValue)
-					} else {
-						values = append(values, Int32(c.Value))
-					}
-				case DoubleSize:
-					if GetFlag(c.Flags, HasEmptyValue) {
-						values = append(values, &gocql.UnsetValue)
-					} else {
-						values = append(values, Float64(c.Value))
-					}
+		err := partition.ReadHeader(reader, &sst.Schema)
+		if err == nil {
+			if last != nil && !last.Less(&partition) {
+				if unordered == 0 {
+					sst.Logger.Warn("partition out of token order", "offset", offset, "token", partition.Token, "previous", last.Token)
 				}
+				unordered++
+			}
+			last = &Partition{Key: partition.Key, Token: partition.Token}
+		}
+		if err == nil && !seek && sst.Filter != nil && !sst.Filter.Match(partition.Token, partition.Components(), sst.Schema.PartitionKey) {
+			// rows are only decoded to skip them, the range is acknowledged with the next partition
+			err = partition.ReadRows(reader, &sst.Schema)
+			if err == nil {
+				sst.Position.Store(reader.Size() - int64(reader.Len()))
+				continue
+			}
+		} else if err == nil {
+			err = partition.ReadRows(reader, &sst.Schema)
+		}
+		if err != nil {
+			// we should have reach eof, acknowledge data after the last loaded partition
+			if offset == reader.Size() && from < offset {
+				ch <- Batch{Source: sst.DataFile, Offset: from, From: from, End: offset, Parts: 1}
 			}
+			if offset < reader.Size() {
+				sst.Logger.Error("decode partition", "offset", offset, "error", err)
+			}
+			break
+		}
+		end := reader.Size() - int64(reader.Len())
+		sst.Position.Store(end)
+
+		batches := bt.batches(&partition, Batch{Source: sst.DataFile, Offset: offset, From: from, End: end})
+
+		// partition without rows, its range is acknowledged with the next one
+		if len(batches) == 0 {
+			continue
+		}
 
-			// send to cql workers
-			rl.Take()
-			ch <- values
-			sst.Queries++
+		// send to cql workers
+		if !bt.send(ctx, batches) {
+			return
+		}
+		from = end
+	}
+}
+
+// batcher group the rows of partitions into batches for the workers.
+type batcher struct {
+	sst   *SSTable
+	ch    chan Batch
+	rl    ratelimit.Limiter
+	now   int64 // expiration is checked against the start time
+	debug bool  // checked once, debug logs cost nothing when disabled
+}
+
+func (sst *SSTable) batcher(ctx context.Context, ch chan Batch) *batcher {
+	rl := sst.Limiter
+	switch {
+	case rl != nil:
+	case sst.Limit > 0:
+		rl = ratelimit.New(sst.Limit)
+	default:
+		rl = ratelimit.NewUnlimited()
+	}
+
+	return &batcher{
+		sst:   sst,
+		ch:    ch,
+		rl:    rl,
+		now:   time.Now().Unix(),
+		debug: sst.Logger.Enabled(ctx, slog.LevelDebug),
+	}
+}
 
-			if sst.Debug && sst.Queries%sst.Sampling == 0 {
-				fmt.Printf("(debug) inserted %d (%d)\n", sst.Queries, len(ch))
+// batches return the batches of the partition rows, bounded by rows and bytes,
+// batch holds the partition source and offsets.
+func (bt *batcher) batches(partition *Partition, batch Batch) []Batch {
+	sst := bt.sst
+
+	var (
+		pvalues []any
+		batches []Batch
+		size    int
+	)
+
+	for _, hk := range partition.HeaderKeys {
+		pvalues = append(pvalues, hk.Value)
+	}
+
+	batch.Key = FormatKey(partition.Components(), sst.Schema.PartitionKey)
+	if bt.debug {
+		sst.Logger.Debug("partition", "key", batch.Key, "token", partition.Token, "offset", batch.Offset, "rows", len(partition.Rows))
+	}
+
+	for _, r := range partition.Rows {
+		values := sst.values(pvalues, &r)
+		if !sst.KeepExpired && !sst.expire(values, &r, bt.now) {
+			sst.ExpiredRows.Add(1)
+			continue
+		}
+		if sst.WriteTime != nil && !sst.window(values, &r) {
+			sst.OutOfWindow.Add(1)
+			continue
+		}
+		rowSize := ValuesSize(values)
+
+		// start a new batch when full
+		if len(batch.Rows) > 0 && (len(batch.Rows) >= sst.BatchSize || size+rowSize > sst.BatchBytes) {
+			batch.Bytes = size
+			batches = append(batches, batch)
+			batch.Rows = nil
+			size = 0
+		}
+
+		bt.rl.Take()
+		if sst.BytesLimiter != nil {
+			sst.BytesLimiter.TakeN(rowSize)
+		}
+		batch.Rows = append(batch.Rows, values)
+		size += rowSize
+		queries := sst.Queries.Add(1)
+
+		if bt.debug && queries%int64(sst.Sampling) == 0 {
+			sst.Logger.Debug("rows decoded", "rows", queries, "queued", len(bt.ch))
+		}
+	}
+
+	if len(batch.Rows) > 0 {
+		batch.Bytes = size
+		batches = append(batches, batch)
+	}
+
+	return batches
+}
+
+// send the batches of a partition to the workers, false if ctx is done.
+func (bt *batcher) send(ctx context.Context, batches []Batch) bool {
+	for _, b := range batches {
+		b.Parts = len(batches)
+		select {
+		case bt.ch <- b:
+		case <-ctx.Done():
+			return false
+		}
+	}
+	return true
+}
+
+// selected return the offsets of the partitions matching the filter from the index file,
+// false if the partitions have to be read and filtered one by one.
+func (sst *SSTable) selected() ([]int64, bool) {
+	if sst.Filter == nil || sst.IndexFile == "" {
+		return nil, false
+	}
+
+	entries, err := ReadIndex(sst.IndexFile)
+	if err != nil {
+		sst.Logger.Warn("filter without index", "error", err)
+		return nil, false
+	}
+
+	var positions []int64
+	for _, e := range entries {
+		if e.Position < sst.Start {
+			continue
+		}
+		components, err := SplitKey(e.Key, sst.Schema.Compound)
+		if err != nil {
+			sst.Logger.Warn("filter without index", "position", e.Position, "error", err)
+			return nil, false
+		}
+		if sst.Filter.Match(Token(e.Key), components, sst.Schema.PartitionKey) {
+			positions = append(positions, e.Position)
+		}
+	}
+	sst.Logger.Debug("partitions selected from index", "selected", len(positions), "partitions", len(entries))
+
+	return positions, true
+}
+
+// values return the values to bind for a row.
+func (sst *SSTable) values(pvalues []any, r *Row) []any {
+	values := make([]any, 0, len(pvalues)+1+len(r.Cells))
+	values = append(values, pvalues...)
+	if len(sst.Schema.Clustering) > 0 {
+		values = append(values, r.ClusteringValue)
+	}
+
+	for _, c := range r.Cells {
+		// Internal type
+		switch c.TypeSize {
+		case TextSize:
+			if string(c.Value) == "" {
+				values = append(values, &gocql.UnsetValue)
+			} else {
+				values = append(values, string(c.Value))
+			}
+		case Int32Size:
+			if GetFlag(c.Flags, HasEmptyValue) {
+				values = append(values, &gocql.UnsetValue)
+			} else {
+				values = append(values, Int32(c.Value))
+			}
+		case DoubleSize:
+			if GetFlag(c.Flags, HasEmptyValue) {
+				values = append(values, &gocql.UnsetValue)
+			} else {
+				values = append(values, Float64(c.Value))
 			}
 		}
 	}
+
+	return values
 }
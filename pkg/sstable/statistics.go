@@ -1,10 +1,46 @@
 package sstable
 
-import "github.com/ghostiam/binstruct"
+import (
+	"strings"
+
+	"github.com/ghostiam/binstruct"
+)
+
+const (
+	MarshalPrefix = "org.apache.cassandra.db.marshal."
+	CompositeType = MarshalPrefix + "CompositeType"
+	ReversedType  = MarshalPrefix + "ReversedType"
+)
+
+// cql names of the simple marshal types
+var cqlTypes = map[string]string{
+	"AsciiType":         "ascii",
+	"BooleanType":       "boolean",
+	"ByteType":          "tinyint",
+	"BytesType":         "blob",
+	"CounterColumnType": "counter",
+	"DateType":          "timestamp",
+	"DecimalType":       "decimal",
+	"DoubleType":        "double",
+	"DurationType":      "duration",
+	"FloatType":         "float",
+	"InetAddressType":   "inet",
+	"Int32Type":         "int",
+	"IntegerType":       "varint",
+	"LongType":          "bigint",
+	"ShortType":         "smallint",
+	"SimpleDateType":    "date",
+	"TimeType":          "time",
+	"TimeUUIDType":      "timeuuid",
+	"TimestampType":     "timestamp",
+	"UTF8Type":          "text",
+	"UUIDType":          "uuid",
+}
 
 type StatisticsInfo struct {
 	TOCIndex      uint32
 	TOC           TOC
+	Stats         StatsMetadata `bin:"offsetStart:TOC.StatisticsOffset"`
 	Serialization Serialization `bin:"offsetStart:TOC.SerializationOffset"`
 }
 
@@ -19,6 +55,31 @@ type TOC struct {
 	SerializationOffset uint32
 }
 
+// StatsMetadata is the beginning of the stats component, up to the fields used.
+type StatsMetadata struct {
+	PartitionSizes       Histogram
+	ColumnCounts         Histogram
+	CommitLogSegment     int64
+	CommitLogPosition    int32
+	MinTimestamp         int64 // microseconds
+	MaxTimestamp         int64 // microseconds
+	MinLocalDeletionTime int32 // seconds
+	MaxLocalDeletionTime int32 // seconds
+	MinTTL               int32
+	MaxTTL               int32
+	CompressionRatio     float64
+}
+
+type Histogram struct {
+	Size    int32
+	Buckets []HistogramBucket `bin:"len:Size"`
+}
+
+type HistogramBucket struct {
+	Offset int64
+	Count  int64
+}
+
 type Serialization struct {
 	MinTimestamp           uint64          `bin:"ReadUvarint"`
 	MinLocalDeletionTIme   uint64          `bin:"ReadUvarint"`
@@ -59,7 +120,53 @@ func (c *Column) GetTypeSize(r binstruct.Reader) (uint64, error) {
 	return GetTypeSize(c.Type), nil
 }
 
+// CQLType return the cql name of a marshal type and whether it is reversed (clustering order desc).
+// Unknown or parameterized types are returned unchanged.
+func CQLType(t string) (string, bool) {
+	reversed := false
+	if strings.HasPrefix(t, ReversedType+"(") && strings.HasSuffix(t, ")") {
+		t = t[len(ReversedType)+1 : len(t)-1]
+		reversed = true
+	}
+
+	if name, ok := cqlTypes[strings.TrimPrefix(t, MarshalPrefix)]; ok {
+		return name, reversed
+	}
+	return t, reversed
+}
+
+// MarshalType return the marshal type of a cql simple type, reversed for a descending clustering order.
+func MarshalType(cql string, reversed bool) (string, bool) {
+	for name, t := range cqlTypes {
+		// timestamp is the TimestampType, DateType is legacy
+		if t != cql || name == "DateType" {
+			continue
+		}
+		if reversed {
+			return ReversedType + "(" + MarshalPrefix + name + ")", true
+		}
+		return MarshalPrefix + name, true
+	}
+	return "", false
+}
+
+// Supported return true if values of the marshal type can be decoded.
+func Supported(t string) bool {
+	switch t {
+	case "org.apache.cassandra.db.marshal.UTF8Type",
+		"org.apache.cassandra.db.marshal.Int32Type",
+		"org.apache.cassandra.db.marshal.DoubleType":
+		return true
+	}
+	return false
+}
+
 func GetTypeSize(t string) uint64 {
+	// a reversed type is serialized as its base type
+	if strings.HasPrefix(t, ReversedType+"(") && strings.HasSuffix(t, ")") {
+		t = t[len(ReversedType)+1 : len(t)-1]
+	}
+
 	switch t {
 	case "org.apache.cassandra.db.marshal.UTF8Type":
 		return TextSize
@@ -70,3 +177,36 @@ func GetTypeSize(t string) uint64 {
 	}
 	return 0
 }
+
+// ParseCompositeType splits a CompositeType(t1,t2,...) into its component types.
+// Any other type is returned as a single component.
+func ParseCompositeType(t string) ([]string, bool) {
+	if !strings.HasPrefix(t, CompositeType+"(") || !strings.HasSuffix(t, ")") {
+		return []string{t}, false
+	}
+
+	var (
+		types []string
+		depth int
+		start int
+	)
+
+	// split on top level commas only, components can be parameterized types
+	inner := t[len(CompositeType)+1 : len(t)-1]
+	for i, c := range inner {
+		switch c {
+		case '(':
+			depth++
+		case ')':
+			depth--
+		case ',':
+			if depth == 0 {
+				types = append(types, inner[start:i])
+				start = i + 1
+			}
+		}
+	}
+	types = append(types, inner[start:])
+
+	return types, true
+}
@@ -2,8 +2,13 @@ package sstable
 
 import (
 	"bytes"
+	"cmp"
 	"encoding/binary"
+	"encoding/hex"
 	"io"
+	"math"
+	"strconv"
+	"strings"
 )
 
 func GetFlag(b, n byte) bool {
@@ -64,3 +69,84 @@ func Float64(b []byte) (ret float64) {
 	binary.Read(buf, binary.BigEndian, &ret)
 	return ret
 }
+
+// ValuesSize return the encoded size of bound values.
+func ValuesSize(values []any) int {
+	size := 0
+	for _, v := range values {
+		switch v := v.(type) {
+		case string:
+			size += len(v)
+		case []byte:
+			size += len(v)
+		case int32:
+			size += 4
+		case float64:
+			size += 8
+		}
+	}
+	return size
+}
+
+// FormatKey return the key components as text according to their types, separated by ':'.
+func FormatKey(components [][]byte, types []string) string {
+	values := make([]string, len(components))
+	for i, c := range components {
+		t := ""
+		if i < len(types) {
+			t = strings.TrimPrefix(types[i], MarshalPrefix)
+		}
+		switch {
+		case t == "UTF8Type" || t == "AsciiType":
+			values[i] = string(c)
+		case t == "Int32Type" && len(c) == 4:
+			values[i] = strconv.FormatInt(int64(Int32(c)), 10)
+		case t == "LongType" && len(c) == 8:
+			values[i] = strconv.FormatInt(int64(binary.BigEndian.Uint64(c)), 10)
+		default:
+			values[i] = "0x" + hex.EncodeToString(c)
+		}
+	}
+	return strings.Join(values, ":")
+}
+
+// CompareValues compare two serialized values in the order of their marshal type,
+// as clustering values are sorted. Unknown types are compared as bytes.
+func CompareValues(t string, a, b []byte) int {
+	if strings.HasPrefix(t, ReversedType+"(") && strings.HasSuffix(t, ")") {
+		return -CompareValues(t[len(ReversedType)+1:len(t)-1], a, b)
+	}
+
+	switch strings.TrimPrefix(t, MarshalPrefix) {
+	case "Int32Type":
+		if len(a) == 4 && len(b) == 4 {
+			return cmp.Compare(Int32(a), Int32(b))
+		}
+	case "DoubleType":
+		if len(a) == 8 && len(b) == 8 {
+			return compareDouble(Float64(a), Float64(b))
+		}
+	}
+	return bytes.Compare(a, b)
+}
+
+// compareDouble compare doubles as java Double.compare does: -0 before 0 and NaN after all.
+func compareDouble(a, b float64) int {
+	switch {
+	case a < b:
+		return -1
+	case a > b:
+		return 1
+	case math.IsNaN(a) && math.IsNaN(b):
+		return 0
+	case math.IsNaN(a):
+		return 1
+	case math.IsNaN(b):
+		return -1
+	case math.Signbit(a) && !math.Signbit(b):
+		return -1
+	case !math.Signbit(a) && math.Signbit(b):
+		return 1
+	}
+	return 0
+}
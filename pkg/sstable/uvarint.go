@@ -33,8 +33,11 @@ func ReadUvarint(r io.Reader) (uint64, error) {
 	firstByteValue := firstByte & firstByteValueMask
 
 	// copy everything at the right place
+	// 9 bytes encoding, the first byte has no value bits
 	pos := 8 - numberOfExtraBytes
-	number[pos-1] = firstByteValue
+	if pos > 0 {
+		number[pos-1] = firstByteValue
+	}
 	for i := pos; i < 8; i++ {
 		n, err := r.Read(buf[:])
 		if err != nil || n != 1 {
@@ -45,3 +48,24 @@ func ReadUvarint(r io.Reader) (uint64, error) {
 
 	return binary.BigEndian.Uint64(number[:]), nil
 }
+
+// UvarintSize return the size of the vint encoding of n.
+func UvarintSize(n uint64) int {
+	magnitude := bits.LeadingZeros64(n | 1)
+	return (639 - magnitude*9) >> 6
+}
+
+// AppendUvarint append the vint encoding of n to b:
+// leading bits set to 1 in the first byte give the number of extra bytes, big endian.
+func AppendUvarint(b []byte, n uint64) []byte {
+	size := UvarintSize(n)
+	if size == 1 {
+		return append(b, byte(n))
+	}
+
+	var number [9]byte
+	binary.BigEndian.PutUint64(number[1:], n)
+	encoded := number[9-size:]
+	encoded[0] |= ^byte(0xff >> (size - 1))
+	return append(b, encoded...)
+}
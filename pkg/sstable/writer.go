@@ -0,0 +1,495 @@
+package sstable
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"hash"
+	"hash/crc32"
+	"math"
+	"os"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/pierrec/lz4"
+)
+
+const (
+	Murmur3Partitioner = "org.apache.cassandra.dht.Murmur3Partitioner"
+	LZ4Compressor      = "org.apache.cassandra.io.compress.LZ4Compressor"
+)
+
+// components of a written sstable, as listed in TOC.txt
+var components = []string{"CompressionInfo.db", "Data.db", "Digest.crc32", "Filter.db", "Index.db", "Statistics.db", "Summary.db", "TOC.txt"}
+
+// an empty sparse HyperLogLogPlus(13, 25) of the compaction metadata,
+// the partitions cardinality is only an estimation used to size the compactions bloom filters
+var emptyCardinality = []byte{0xff, 0xff, 0xff, 0xfe, 13, 25, 1, 0}
+
+// Writer write partitions in token order to a new mc sstable: LZ4 compressed Data.db with
+// chunks crc, Index.db, Summary.db, Filter.db, Statistics.db, CompressionInfo.db, Digest.crc32 and TOC.txt.
+// Partitions are serialized as read, rows timestamps and times being deltas from the Schema minimums.
+// Large partitions have no promoted index, statistics have no tombstones histogram nor clustering bounds.
+type Writer struct {
+	Prefix        string  // files path prefix, as dir/mc-1-big
+	Schema        Schema  // columns ordered by name
+	ChunkLength   int     // uncompressed bytes by Data.db chunk
+	IndexInterval int     // Index.db entries by Summary.db entry
+	FPChance      float64 // Filter.db false positive chance
+	Partitions    int64   // partitions written
+	Rows          int64   // rows written
+
+	data          *os.File
+	dataw         *bufio.Writer
+	digest        hash.Hash32
+	index         *os.File
+	indexw        *bufio.Writer
+	buf           []byte       // serialized partition
+	chunk         []byte       // uncompressed data not written yet
+	offsets       []int64      // Data.db chunks offsets
+	position      int64        // uncompressed data length
+	compressed    int64        // Data.db length
+	indexPosition int64        // Index.db length
+	summary       []IndexEntry // sampled index entries, with their Index.db position
+	hashes        [][2]uint64  // partition keys murmur3 hashes
+	first, last   []byte       // partition keys
+	token         int64        // last partition token
+	stats         *writerStats
+}
+
+// NewWriter create the Data.db and Index.db files of an sstable,
+// the other components are written on Close.
+func NewWriter(prefix string, schema Schema) (*Writer, error) {
+	for i := 1; i < len(schema.Columns); i++ {
+		if schema.Columns[i-1].Name >= schema.Columns[i].Name {
+			return nil, fmt.Errorf("columns %s and %s: not ordered by name", schema.Columns[i-1].Name, schema.Columns[i].Name)
+		}
+	}
+
+	w := &Writer{
+		Prefix:        prefix,
+		Schema:        schema,
+		ChunkLength:   64 * 1024,
+		IndexInterval: 128,
+		FPChance:      0.01,
+		digest:        crc32.NewIEEE(),
+		stats:         newWriterStats(),
+	}
+
+	var err error
+	w.data, err = os.Create(prefix + "-Data.db")
+	if err != nil {
+		return nil, fmt.Errorf("create data-file: %w", err)
+	}
+	w.index, err = os.Create(prefix + "-Index.db")
+	if err != nil {
+		w.data.Close()
+		return nil, fmt.Errorf("create index-file: %w", err)
+	}
+	w.dataw = bufio.NewWriter(w.data)
+	w.indexw = bufio.NewWriter(w.index)
+
+	return w, nil
+}
+
+// Write append a partition, after the previous one in token then key order.
+func (w *Writer) Write(partition *Partition) error {
+	key := partition.Key
+	if key == nil {
+		key = JoinKey(partition.Components(), w.Schema.Compound)
+	}
+	token := Token(key)
+	if w.Partitions > 0 && (token < w.token || token == w.token && bytes.Compare(key, w.last) <= 0) {
+		return fmt.Errorf("write partition 0x%x: not after the previous one", key)
+	}
+
+	var err error
+	w.buf, err = partition.Append(w.buf[:0], &w.Schema)
+	if err != nil {
+		return fmt.Errorf("write partition 0x%x: %w", key, err)
+	}
+
+	// index entry without promoted index, sampled in the summary
+	key = bytes.Clone(key)
+	if w.Partitions%int64(w.IndexInterval) == 0 {
+		w.summary = append(w.summary, IndexEntry{Key: key, Position: w.indexPosition})
+	}
+	entry := binary.BigEndian.AppendUint16(nil, uint16(len(key)))
+	entry = append(entry, key...)
+	entry = AppendUvarint(entry, uint64(w.position))
+	entry = AppendUvarint(entry, 0)
+	_, err = w.indexw.Write(entry)
+	if err != nil {
+		return fmt.Errorf("write index-file: %w", err)
+	}
+	w.indexPosition += int64(len(entry))
+
+	err = w.write(w.buf)
+	if err != nil {
+		return err
+	}
+
+	h1, h2 := Murmur3(key)
+	w.hashes = append(w.hashes, [2]uint64{h1, h2})
+	w.stats.partition(partition, &w.Schema, len(w.buf))
+	if w.Partitions == 0 {
+		w.first = key
+	}
+	w.last = key
+	w.token = token
+	w.Partitions++
+	w.Rows += int64(len(partition.Rows))
+
+	return nil
+}
+
+// write uncompressed data, full chunks are compressed.
+func (w *Writer) write(b []byte) error {
+	w.chunk = append(w.chunk, b...)
+	w.position += int64(len(b))
+
+	for len(w.chunk) >= w.ChunkLength {
+		err := w.flush(w.chunk[:w.ChunkLength])
+		if err != nil {
+			return err
+		}
+		w.chunk = append(w.chunk[:0], w.chunk[w.ChunkLength:]...)
+	}
+
+	return nil
+}
+
+// flush a chunk: little endian uncompressed length, lz4 block and big endian crc32 of both.
+func (w *Writer) flush(chunk []byte) error {
+	compressed := make([]byte, 4+lz4.CompressBlockBound(len(chunk)))
+	binary.LittleEndian.PutUint32(compressed, uint32(len(chunk)))
+	n, err := lz4.CompressBlock(chunk, compressed[4:], nil)
+	if err != nil {
+		return fmt.Errorf("compress lz4 data-chunk: %w", err)
+	}
+	compressed = compressed[:4+n]
+	compressed = binary.BigEndian.AppendUint32(compressed, crc32.ChecksumIEEE(compressed))
+
+	_, err = w.dataw.Write(compressed)
+	if err != nil {
+		return fmt.Errorf("write data-file: %w", err)
+	}
+	w.digest.Write(compressed)
+	w.offsets = append(w.offsets, w.compressed)
+	w.compressed += int64(len(compressed))
+
+	return nil
+}
+
+// Close write the last chunk and the other components.
+func (w *Writer) Close() error {
+	defer w.data.Close()
+	defer w.index.Close()
+
+	if len(w.chunk) > 0 {
+		err := w.flush(w.chunk)
+		if err != nil {
+			return err
+		}
+	}
+	err := w.dataw.Flush()
+	if err != nil {
+		return fmt.Errorf("write data-file: %w", err)
+	}
+	err = w.indexw.Flush()
+	if err != nil {
+		return fmt.Errorf("write index-file: %w", err)
+	}
+
+	filter := newBloom(len(w.hashes), w.FPChance)
+	for _, h := range w.hashes {
+		filter.add(h[0], h[1])
+	}
+
+	files := []struct {
+		component string
+		data      []byte
+	}{
+		{"CompressionInfo.db", w.compressionInfo()},
+		{"Statistics.db", w.statistics()},
+		{"Summary.db", w.summaryFile()},
+		{"Filter.db", filter.Append(nil)},
+		{"Digest.crc32", []byte(strconv.FormatUint(uint64(w.digest.Sum32()), 10))},
+		{"TOC.txt", []byte(strings.Join(components, "\n") + "\n")},
+	}
+	for _, f := range files {
+		err = os.WriteFile(w.Prefix+"-"+f.component, f.data, 0644)
+		if err != nil {
+			return fmt.Errorf("write %s: %w", f.component, err)
+		}
+	}
+
+	return nil
+}
+
+// Abort close the files and remove the components written so far, after a failed Write or Close.
+func (w *Writer) Abort() error {
+	w.data.Close()
+	w.index.Close()
+
+	var errs []error
+	for _, c := range components {
+		err := os.Remove(w.Prefix + "-" + c)
+		if err != nil && !errors.Is(err, os.ErrNotExist) {
+			errs = append(errs, fmt.Errorf("remove %s: %w", c, err))
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// compressionInfo serialize the compressor, the chunk length, the uncompressed length and the chunks offsets.
+func (w *Writer) compressionInfo() []byte {
+	b := appendShortString(nil, LZ4Compressor)
+	b = binary.BigEndian.AppendUint32(b, 0)
+	b = binary.BigEndian.AppendUint32(b, uint32(w.ChunkLength))
+	b = binary.BigEndian.AppendUint64(b, uint64(w.position))
+	b = binary.BigEndian.AppendUint32(b, uint32(len(w.offsets)))
+	for _, offset := range w.offsets {
+		b = binary.BigEndian.AppendUint64(b, uint64(offset))
+	}
+	return b
+}
+
+// summaryFile serialize the sampled index entries, with native (little endian) offsets and positions,
+// followed by the first and last keys.
+func (w *Writer) summaryFile() []byte {
+	var offsets, entries []byte
+	for _, e := range w.summary {
+		offsets = binary.LittleEndian.AppendUint32(offsets, uint32(4*len(w.summary)+len(entries)))
+		entries = append(entries, e.Key...)
+		entries = binary.LittleEndian.AppendUint64(entries, uint64(e.Position))
+	}
+
+	b := binary.BigEndian.AppendUint32(nil, uint32(w.IndexInterval))
+	b = binary.BigEndian.AppendUint32(b, uint32(len(w.summary)))
+	b = binary.BigEndian.AppendUint64(b, uint64(len(offsets)+len(entries)))
+	b = binary.BigEndian.AppendUint32(b, 128) // full sampling level
+	b = binary.BigEndian.AppendUint32(b, uint32(len(w.summary)))
+	b = append(b, offsets...)
+	b = append(b, entries...)
+	b = binary.BigEndian.AppendUint32(b, uint32(len(w.first)))
+	b = append(b, w.first...)
+	b = binary.BigEndian.AppendUint32(b, uint32(len(w.last)))
+	return append(b, w.last...)
+}
+
+// statistics serialize the table of contents then the validation, compaction, stats and serialization header components.
+func (w *Writer) statistics() []byte {
+	validation := appendShortString(nil, Murmur3Partitioner)
+	validation = binary.BigEndian.AppendUint64(validation, math.Float64bits(w.FPChance))
+
+	compaction := binary.BigEndian.AppendUint32(nil, uint32(len(emptyCardinality)))
+	compaction = append(compaction, emptyCardinality...)
+
+	ratio := -1.0
+	if w.position > 0 {
+		ratio = float64(w.compressed) / float64(w.position)
+	}
+	stats := w.stats.Append(nil, ratio)
+
+	header := AppendUvarint(nil, uint64(w.Schema.MinTimestamp-TimestampEpoch))
+	header = AppendUvarint(header, uint64(w.Schema.MinLocalDeletionTime-LocalDeletionTimeEpoch))
+	header = AppendUvarint(header, uint64(w.Schema.MinTTL))
+	keyType := w.Schema.PartitionKey[0]
+	if w.Schema.Compound {
+		keyType = CompositeType + "(" + strings.Join(w.Schema.PartitionKey, ",") + ")"
+	}
+	header = appendVString(header, keyType)
+	header = AppendUvarint(header, uint64(len(w.Schema.Clustering)))
+	for _, t := range w.Schema.Clustering {
+		header = appendVString(header, t)
+	}
+	header = AppendUvarint(header, 0) // static columns
+	header = AppendUvarint(header, uint64(len(w.Schema.Columns)))
+	for _, c := range w.Schema.Columns {
+		header = appendVString(header, c.Name)
+		header = appendVString(header, c.Type)
+	}
+
+	// components types and offsets
+	parts := [][]byte{validation, compaction, stats, header}
+	b := binary.BigEndian.AppendUint32(nil, uint32(len(parts)))
+	offset := 4 + 8*len(parts)
+	for i, part := range parts {
+		b = binary.BigEndian.AppendUint32(b, uint32(i))
+		b = binary.BigEndian.AppendUint32(b, uint32(offset))
+		offset += len(part)
+	}
+	for _, part := range parts {
+		b = append(b, part...)
+	}
+	return b
+}
+
+// appendShortString append a string with its uint16 length.
+func appendShortString(b []byte, s string) []byte {
+	b = binary.BigEndian.AppendUint16(b, uint16(len(s)))
+	return append(b, s...)
+}
+
+// appendVString append a string with its vint length.
+func appendVString(b []byte, s string) []byte {
+	b = AppendUvarint(b, uint64(len(s)))
+	return append(b, s...)
+}
+
+// writerStats collect the stats metadata of the written data, as cassandra does:
+// live data has no ttl and never expires.
+type writerStats struct {
+	minTimestamp, maxTimestamp int64
+	minDeletion, maxDeletion   int64
+	minTTL, maxTTL             int64
+	partitionSizes, cellCounts *estimatedHistogram
+	cells, rows                int64
+	empty                      bool
+}
+
+func newWriterStats() *writerStats {
+	return &writerStats{
+		minTimestamp:   math.MaxInt64,
+		maxTimestamp:   math.MinInt64,
+		minDeletion:    math.MaxInt64,
+		maxDeletion:    math.MinInt64,
+		minTTL:         math.MaxInt64,
+		maxTTL:         math.MinInt64,
+		partitionSizes: newEstimatedHistogram(150),
+		cellCounts:     newEstimatedHistogram(114),
+		empty:          true,
+	}
+}
+
+func (s *writerStats) update(timestamp, deletion, ttl int64) {
+	s.minTimestamp = min(s.minTimestamp, timestamp)
+	s.maxTimestamp = max(s.maxTimestamp, timestamp)
+	s.minDeletion = min(s.minDeletion, deletion)
+	s.maxDeletion = max(s.maxDeletion, deletion)
+	s.minTTL = min(s.minTTL, ttl)
+	s.maxTTL = max(s.maxTTL, ttl)
+	s.empty = false
+}
+
+// partition account a partition of size serialized bytes.
+func (s *writerStats) partition(partition *Partition, schema *Schema, size int) {
+	if partition.HeaderMarkedforDeleteAt != LiveMarkedForDeleteAt {
+		s.update(int64(partition.HeaderMarkedforDeleteAt), int64(partition.HeaderLocalDeletiontime), 0)
+	}
+
+	cells := 0
+	for i := range partition.Rows {
+		row := &partition.Rows[i]
+		s.rows++
+
+		if t, ok := row.WriteTime(schema); ok {
+			if expiration, ok := row.ExpirationTime(schema); ok {
+				s.update(t, expiration, schema.MinTTL+int64(row.TTL))
+			} else {
+				s.update(t, math.MaxInt32, 0)
+			}
+		}
+		if GetFlag(row.Flags, HasDeletion) {
+			s.update(schema.MinTimestamp+int64(row.DeletionTimestamp), schema.MinLocalDeletionTime+int64(row.LocalDeletionTime), 0)
+		}
+
+		for j := range row.Cells {
+			if row.Missing(j) {
+				continue
+			}
+			cell := &row.Cells[j]
+			t := cell.WriteTime(row, schema)
+			switch {
+			case GetFlag(cell.Flags, IsExpiring):
+				expiration, _ := cell.ExpirationTime(row, schema)
+				ttl := cell.TTL
+				if GetFlag(cell.Flags, UseRowTTL) {
+					ttl = row.TTL
+				}
+				s.update(t, expiration, schema.MinTTL+int64(ttl))
+			case GetFlag(cell.Flags, IsDeleted):
+				s.update(t, schema.MinLocalDeletionTime+int64(cell.LocalDeletionTime), 0)
+			default:
+				s.update(t, math.MaxInt32, 0)
+			}
+			cells++
+		}
+	}
+
+	s.cells += int64(cells)
+	s.partitionSizes.add(int64(size))
+	s.cellCounts.add(int64(cells))
+}
+
+// Append serialize the stats metadata, up to the commit log intervals.
+func (s *writerStats) Append(b []byte, ratio float64) []byte {
+	if s.empty {
+		s.update(0, math.MaxInt32, 0)
+	}
+
+	b = s.partitionSizes.Append(b)
+	b = s.cellCounts.Append(b)
+	b = binary.BigEndian.AppendUint64(b, math.MaxUint64) // commit log upper bound: none
+	b = binary.BigEndian.AppendUint32(b, 0)
+	b = binary.BigEndian.AppendUint64(b, uint64(s.minTimestamp))
+	b = binary.BigEndian.AppendUint64(b, uint64(s.maxTimestamp))
+	b = binary.BigEndian.AppendUint32(b, uint32(min(s.minDeletion, math.MaxInt32)))
+	b = binary.BigEndian.AppendUint32(b, uint32(min(s.maxDeletion, math.MaxInt32)))
+	b = binary.BigEndian.AppendUint32(b, uint32(s.minTTL))
+	b = binary.BigEndian.AppendUint32(b, uint32(s.maxTTL))
+	b = binary.BigEndian.AppendUint64(b, math.Float64bits(ratio))
+	b = binary.BigEndian.AppendUint32(b, 100) // tombstones histogram: max bins and no bin
+	b = binary.BigEndian.AppendUint32(b, 0)
+	b = binary.BigEndian.AppendUint32(b, 0)               // level
+	b = binary.BigEndian.AppendUint64(b, 0)               // repaired at
+	b = binary.BigEndian.AppendUint32(b, 0)               // min clustering values
+	b = binary.BigEndian.AppendUint32(b, 0)               // max clustering values
+	b = append(b, 0)                                      // legacy counter shards
+	b = binary.BigEndian.AppendUint64(b, uint64(s.cells)) // columns set
+	b = binary.BigEndian.AppendUint64(b, uint64(s.rows))
+	b = binary.BigEndian.AppendUint64(b, math.MaxUint64) // commit log lower bound: none
+	b = binary.BigEndian.AppendUint32(b, 0)
+	return binary.BigEndian.AppendUint32(b, 0) // commit log intervals
+}
+
+// estimatedHistogram count values in buckets growing by 20%, the last one for larger values.
+type estimatedHistogram struct {
+	offsets []int64
+	buckets []int64
+}
+
+func newEstimatedHistogram(n int) *estimatedHistogram {
+	h := &estimatedHistogram{offsets: make([]int64, n), buckets: make([]int64, n+1)}
+	last := int64(1)
+	h.offsets[0] = last
+	for i := 1; i < n; i++ {
+		next := int64(math.Round(float64(last) * 1.2))
+		if next == last {
+			next++
+		}
+		h.offsets[i] = next
+		last = next
+	}
+	return h
+}
+
+// add a value to the first bucket whose offset is greater or equal.
+func (h *estimatedHistogram) add(v int64) {
+	i, _ := slices.BinarySearch(h.offsets, v)
+	h.buckets[i]++
+}
+
+// Append serialize the buckets count, then each bucket lower offset and count.
+func (h *estimatedHistogram) Append(b []byte) []byte {
+	b = binary.BigEndian.AppendUint32(b, uint32(len(h.buckets)))
+	for i, count := range h.buckets {
+		b = binary.BigEndian.AppendUint64(b, uint64(h.offsets[max(i-1, 0)]))
+		b = binary.BigEndian.AppendUint64(b, uint64(count))
+	}
+	return b
+}
@@ -0,0 +1,456 @@
+package sstable
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"fmt"
+	"hash/crc32"
+	"os"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gocql/gocql"
+)
+
+// testSchema has a text partition key, a descending int clustering key and a column of each supported type.
+func testSchema() Schema {
+	now := time.Now()
+	return Schema{
+		MinTimestamp:         now.UnixMicro(),
+		MinLocalDeletionTime: now.Unix() + 3600,
+		MinTTL:               3600,
+		PartitionKey:         []string{MarshalPrefix + "UTF8Type"},
+		Clustering:           []string{ReversedType + "(" + MarshalPrefix + "Int32Type)"},
+		Columns: []SchemaEntry{
+			{Name: "a", Type: MarshalPrefix + "UTF8Type", Size: TextSize},
+			{Name: "b", Type: MarshalPrefix + "Int32Type", Size: Int32Size},
+			{Name: "c", Type: MarshalPrefix + "DoubleType", Size: DoubleSize},
+		},
+	}
+}
+
+// testPartitions return n partitions in token order of 3 rows in descending clustering order:
+// one with all columns, one without column b and one with a ttl.
+func testPartitions(n int) []Partition {
+	partitions := make([]Partition, n)
+	for i := range partitions {
+		key := []byte(fmt.Sprintf("key-%d", i))
+		p := Partition{
+			HeaderKeys:              []HeaderKey{{Value: key}},
+			HeaderLocalDeletiontime: LiveLocalDeletionTime,
+			HeaderMarkedforDeleteAt: LiveMarkedForDeleteAt,
+			Key:                     key,
+			Token:                   Token(key),
+		}
+		for ck := int32(3); ck > 0; ck-- {
+			clustering := binary.BigEndian.AppendUint32(nil, uint32(ck))
+			row := Row{Flags: HasTimestamp | HasAllColumns, ClusteringValue: clustering, Timestamp: uint64(i)}
+			flags := UseRowTimestamp
+			if ck == 1 {
+				row.Flags |= HasTTL
+				row.DeletionTime = uint64(i)
+				flags |= IsExpiring | UseRowTTL
+			}
+			row.Cells = []Cell{
+				{TypeSize: TextSize, Flags: flags, Value: []byte(fmt.Sprintf("a-%d-%d", i, ck))},
+				{TypeSize: Int32Size, Flags: flags, Value: binary.BigEndian.AppendUint32(nil, uint32(i))},
+				{TypeSize: DoubleSize, Flags: flags, Value: binary.BigEndian.AppendUint64(nil, uint64(i)<<32)},
+			}
+			if ck == 2 {
+				row.Flags &^= HasAllColumns
+				row.MissingColumns = 1 << 1
+				row.Cells[1] = Cell{TypeSize: Int32Size, Flags: HasEmptyValue}
+			}
+			p.Rows = append(p.Rows, row)
+		}
+		partitions[i] = p
+	}
+
+	slices.SortFunc(partitions, func(p, q Partition) int {
+		if p.Less(&q) {
+			return -1
+		}
+		return 1
+	})
+	return partitions
+}
+
+// writeTest write the partitions as an sstable of small chunks, returning its files prefix.
+func writeTest(t *testing.T, schema Schema, partitions []Partition) (string, *Writer) {
+	t.Helper()
+
+	prefix := filepath.Join(t.TempDir(), "mc-1-big")
+	w, err := NewWriter(prefix, schema)
+	if err != nil {
+		t.Fatal(err)
+	}
+	w.ChunkLength = 4096
+	for i := range partitions {
+		err = w.Write(&partitions[i])
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	err = w.Close()
+	if err != nil {
+		t.Fatal(err)
+	}
+	return prefix, w
+}
+
+func readTest(t *testing.T, prefix string) *SSTable {
+	t.Helper()
+
+	sst := New()
+	sst.DataFile = prefix + "-Data.db"
+	sst.StatisticsFile = prefix + "-Statistics.db"
+	sst.CompressionFile = prefix + "-CompressionInfo.db"
+	sst.BatchSize = 100
+	sst.BatchBytes = 1 << 20
+	sst.Sampling = 1
+	err := sst.ReadStatistics()
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = sst.ReadData()
+	if err != nil {
+		t.Fatal(err)
+	}
+	return sst
+}
+
+func TestWriterRoundTrip(t *testing.T) {
+	schema := testSchema()
+	partitions := testPartitions(300)
+	prefix, w := writeTest(t, schema, partitions)
+	if w.Partitions != 300 || w.Rows != 900 {
+		t.Fatalf("written %d partitions and %d rows, want 300 and 900", w.Partitions, w.Rows)
+	}
+	if len(w.offsets) < 2 {
+		t.Fatalf("%d data chunks, want several", len(w.offsets))
+	}
+
+	sst := readTest(t, prefix)
+
+	// serialization header and stats
+	got := sst.Schema
+	if got.MinTimestamp != schema.MinTimestamp || got.MinLocalDeletionTime != schema.MinLocalDeletionTime || got.MinTTL != schema.MinTTL {
+		t.Errorf("schema minimums %d %d %d, want %d %d %d", got.MinTimestamp, got.MinLocalDeletionTime, got.MinTTL,
+			schema.MinTimestamp, schema.MinLocalDeletionTime, schema.MinTTL)
+	}
+	if got.Compound || !slices.Equal(got.PartitionKey, schema.PartitionKey) || !slices.Equal(got.Clustering, schema.Clustering) {
+		t.Errorf("schema keys %v %v %v, want %v %v", got.Compound, got.PartitionKey, got.Clustering, schema.PartitionKey, schema.Clustering)
+	}
+	if !slices.Equal(got.Columns, schema.Columns) {
+		t.Errorf("schema columns %v, want %v", got.Columns, schema.Columns)
+	}
+	if sst.Stats.MinTimestamp != schema.MinTimestamp || sst.Stats.MaxTimestamp != schema.MinTimestamp+299 {
+		t.Errorf("stats timestamps [%d, %d], want [%d, %d]", sst.Stats.MinTimestamp, sst.Stats.MaxTimestamp, schema.MinTimestamp, schema.MinTimestamp+299)
+	}
+	if sst.Stats.MinTTL != 0 || sst.Stats.MaxTTL != int32(schema.MinTTL) {
+		t.Errorf("stats ttls [%d, %d], want [0, %d]", sst.Stats.MinTTL, sst.Stats.MaxTTL, schema.MinTTL)
+	}
+	if sst.DataLength != w.position || int64(len(sst.data)) != w.position {
+		t.Errorf("data length %d, decompressed %d, want %d", sst.DataLength, len(sst.data), w.position)
+	}
+
+	// fixed size clustering values have no length, even reversed: flags, header and value
+	first := partitions[0]
+	row := sst.data[2+len(first.Key)+12:]
+	if want := append([]byte{first.Rows[0].Flags, 0}, first.Rows[0].ClusteringValue...); !bytes.HasPrefix(row, want) {
+		t.Errorf("first row starting with % x, want % x", row[:len(want)], want)
+	}
+
+	// partitions and rows as written, with their offsets
+	var offsets []int64
+	reader := bytes.NewReader(sst.data)
+	for i := range partitions {
+		offsets = append(offsets, reader.Size()-int64(reader.Len()))
+		p := Partition{}
+		err := p.Read(reader, &sst.Schema)
+		if err != nil {
+			t.Fatalf("partition %d: %v", i, err)
+		}
+		want := &partitions[i]
+		if !bytes.Equal(p.Key, want.Key) || p.Token != want.Token || len(p.Rows) != len(want.Rows) {
+			t.Fatalf("partition %d: key %q token %d rows %d, want %q %d %d", i, p.Key, p.Token, len(p.Rows), want.Key, want.Token, len(want.Rows))
+		}
+		for j := range p.Rows {
+			r, wr := &p.Rows[j], &want.Rows[j]
+			if r.Flags != wr.Flags || !bytes.Equal(r.ClusteringValue, wr.ClusteringValue) || r.Timestamp != wr.Timestamp ||
+				r.DeletionTime != wr.DeletionTime || r.MissingColumns != wr.MissingColumns {
+				t.Fatalf("partition %d row %d: %+v, want %+v", i, j, r, wr)
+			}
+			for k := range r.Cells {
+				c, wc := &r.Cells[k], &wr.Cells[k]
+				if c.Flags != wc.Flags || !bytes.Equal(c.Value, wc.Value) {
+					t.Fatalf("partition %d row %d cell %d: %+v, want %+v", i, j, k, c, wc)
+				}
+			}
+		}
+	}
+	if reader.Len() != 0 {
+		t.Errorf("%d bytes after the last partition", reader.Len())
+	}
+
+	// index entries at the partitions offsets
+	entries, err := ReadIndex(prefix + "-Index.db")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(entries) != len(partitions) {
+		t.Fatalf("%d index entries, want %d", len(entries), len(partitions))
+	}
+	for i, e := range entries {
+		if !bytes.Equal(e.Key, partitions[i].Key) || e.Position != offsets[i] {
+			t.Fatalf("index entry %d: %q at %d, want %q at %d", i, e.Key, e.Position, partitions[i].Key, offsets[i])
+		}
+	}
+
+	// rows values as loaded
+	ch := make(chan Batch, 1000)
+	sst.ReadPartitions(context.Background(), ch)
+	close(ch)
+	rows := 0
+	for batch := range ch {
+		for _, values := range batch.Rows {
+			rows++
+			if len(values) != 5 {
+				t.Fatalf("row of %d values, want 5", len(values))
+			}
+			if values[3] == any(&gocql.UnsetValue) {
+				continue
+			}
+			if _, ok := values[3].(int32); !ok {
+				t.Fatalf("column b value %v, want an int32", values[3])
+			}
+		}
+	}
+	if rows != 900 {
+		t.Errorf("%d rows loaded, want 900", rows)
+	}
+}
+
+func TestWriterComponents(t *testing.T) {
+	partitions := testPartitions(300)
+	prefix, w := writeTest(t, testSchema(), partitions)
+
+	// summary: one entry every 128 index entries, then the first and last keys
+	summary, err := os.ReadFile(prefix + "-Summary.db")
+	if err != nil {
+		t.Fatal(err)
+	}
+	entries, err := ReadIndex(prefix + "-Index.db")
+	if err != nil {
+		t.Fatal(err)
+	}
+	var positions []int64
+	var position int64
+	for _, e := range entries {
+		positions = append(positions, position)
+		position += int64(2 + len(e.Key) + UvarintSize(uint64(e.Position)) + 1)
+	}
+
+	be := binary.BigEndian
+	interval, count, size := be.Uint32(summary), be.Uint32(summary[4:]), be.Uint64(summary[8:])
+	sampling, full := be.Uint32(summary[16:]), be.Uint32(summary[20:])
+	if interval != 128 || count != 3 || sampling != 128 || full != 3 {
+		t.Fatalf("summary header %d %d %d %d, want 128 3 128 3", interval, count, sampling, full)
+	}
+	body := summary[24 : 24+size]
+	for i := 0; i < int(count); i++ {
+		offset := binary.LittleEndian.Uint32(body[4*i:])
+		end := uint32(len(body))
+		if i+1 < int(count) {
+			end = binary.LittleEndian.Uint32(body[4*(i+1):])
+		}
+		entry := body[offset:end]
+		key, pos := entry[:len(entry)-8], int64(binary.LittleEndian.Uint64(entry[len(entry)-8:]))
+		if !bytes.Equal(key, partitions[128*i].Key) || pos != positions[128*i] {
+			t.Errorf("summary entry %d: %q at %d, want %q at %d", i, key, pos, partitions[128*i].Key, positions[128*i])
+		}
+	}
+	bounds := summary[24+size:]
+	first := bounds[4 : 4+be.Uint32(bounds)]
+	bounds = bounds[4+len(first):]
+	last := bounds[4 : 4+be.Uint32(bounds)]
+	if !bytes.Equal(first, partitions[0].Key) || !bytes.Equal(last, partitions[299].Key) {
+		t.Errorf("summary keys %q and %q, want %q and %q", first, last, partitions[0].Key, partitions[299].Key)
+	}
+
+	// filter: 5 hashes and 10 bits by key plus 20 for a 1% chance, with all keys set
+	filter, err := os.ReadFile(prefix + "-Filter.db")
+	if err != nil {
+		t.Fatal(err)
+	}
+	hashes, words := be.Uint32(filter), be.Uint32(filter[4:])
+	if hashes != 5 || words != (300*10+20-1)/64+1 || len(filter) != 8+8*int(words) {
+		t.Fatalf("filter of %d hashes and %d words in %d bytes", hashes, words, len(filter))
+	}
+	bits := make([]uint64, words)
+	for i := range bits {
+		bits[i] = be.Uint64(filter[8+8*i:])
+	}
+	contains := func(key []byte) bool {
+		h1, h2 := Murmur3(key)
+		capacity := int64(words) * 64
+		for i := int64(0); i < int64(hashes); i++ {
+			index := (int64(h2) + i*int64(h1)) % capacity
+			if index < 0 {
+				index = -index
+			}
+			if bits[index/64]&(1<<(index%64)) == 0 {
+				return false
+			}
+		}
+		return true
+	}
+	for _, p := range partitions {
+		if !contains(p.Key) {
+			t.Fatalf("key %q not in filter", p.Key)
+		}
+	}
+	positives := 0
+	for i := 0; i < 10000; i++ {
+		if contains([]byte(fmt.Sprintf("absent-%d", i))) {
+			positives++
+		}
+	}
+	if positives > 300 {
+		t.Errorf("%d false positives of 10000 keys", positives)
+	}
+
+	// digest of the compressed data and table of contents
+	data, err := os.ReadFile(prefix + "-Data.db")
+	if err != nil {
+		t.Fatal(err)
+	}
+	digest, err := os.ReadFile(prefix + "-Digest.crc32")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(digest) != strconv.FormatUint(uint64(crc32.ChecksumIEEE(data)), 10) {
+		t.Errorf("digest %s of %d bytes data", digest, len(data))
+	}
+	if int64(len(data)) != w.compressed {
+		t.Errorf("data of %d bytes, want %d", len(data), w.compressed)
+	}
+	toc, err := os.ReadFile(prefix + "-TOC.txt")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, c := range components {
+		if !strings.Contains(string(toc), c+"\n") {
+			t.Errorf("%s not in TOC.txt", c)
+		}
+		if _, err := os.Stat(prefix + "-" + c); err != nil {
+			t.Error(err)
+		}
+	}
+}
+
+func TestWriterOrder(t *testing.T) {
+	partitions := testPartitions(2)
+	prefix := filepath.Join(t.TempDir(), "mc-1-big")
+	w, err := NewWriter(prefix, testSchema())
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = w.Write(&partitions[1])
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = w.Write(&partitions[0])
+	if err == nil {
+		t.Fatal("partition written before the previous one")
+	}
+
+	err = w.Abort()
+	if err != nil {
+		t.Fatal(err)
+	}
+	files, _ := filepath.Glob(prefix + "-*")
+	if len(files) > 0 {
+		t.Errorf("files left after abort: %v", files)
+	}
+}
+
+func TestWriterClustering(t *testing.T) {
+	int32Type := MarshalPrefix + "Int32Type"
+	text := MarshalPrefix + "UTF8Type"
+	tests := []struct {
+		name       string
+		clustering []string
+		values     [][]byte // clustering values of the rows, in order
+	}{
+		{"no clustering column", nil, [][]byte{nil}},
+		{"int clustering column", []string{int32Type}, [][]byte{{0, 0, 0, 1}, {0, 0, 0, 2}, {0, 0, 0, 3}}},
+		{"reversed int clustering column", []string{ReversedType + "(" + int32Type + ")"}, [][]byte{{0, 0, 0, 3}, {0, 0, 0, 2}, {0, 0, 0, 1}}},
+		{"text clustering column", []string{text}, [][]byte{nil, []byte("a"), []byte("b")}},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			schema := testSchema()
+			schema.Clustering = test.clustering
+			partitions := testPartitions(50)
+			for i := range partitions {
+				p := &partitions[i]
+				p.Rows = p.Rows[:len(test.values)]
+				for j := range p.Rows {
+					p.Rows[j].ClusteringValue = test.values[j]
+				}
+			}
+			prefix, _ := writeTest(t, schema, partitions)
+			sst := readTest(t, prefix)
+			if !slices.Equal(sst.Schema.Clustering, test.clustering) {
+				t.Fatalf("clustering %v, want %v", sst.Schema.Clustering, test.clustering)
+			}
+
+			reader := bytes.NewReader(sst.data)
+			for i := range partitions {
+				p := Partition{}
+				err := p.Read(reader, &sst.Schema)
+				if err != nil {
+					t.Fatalf("partition %d: %v", i, err)
+				}
+				want := &partitions[i]
+				if !bytes.Equal(p.Key, want.Key) || len(p.Rows) != len(want.Rows) {
+					t.Fatalf("partition %d: key %q rows %d, want %q %d", i, p.Key, len(p.Rows), want.Key, len(want.Rows))
+				}
+				for j := range p.Rows {
+					r, wr := &p.Rows[j], &want.Rows[j]
+					if !bytes.Equal(r.ClusteringValue, wr.ClusteringValue) || len(r.Cells) != len(wr.Cells) ||
+						!bytes.Equal(r.Cells[0].Value, wr.Cells[0].Value) {
+						t.Fatalf("partition %d row %d: %+v, want %+v", i, j, r, wr)
+					}
+				}
+			}
+			if reader.Len() != 0 {
+				t.Errorf("%d bytes after the last partition", reader.Len())
+			}
+
+			// the loaded rows have a value for the clustering column only if there is one
+			ch := make(chan Batch, 1000)
+			sst.ReadPartitions(context.Background(), ch)
+			close(ch)
+			rows := 0
+			for batch := range ch {
+				for _, values := range batch.Rows {
+					rows++
+					if len(values) != 1+len(test.clustering)+3 {
+						t.Fatalf("row of %d values, want %d", len(values), 1+len(test.clustering)+3)
+					}
+				}
+			}
+			if rows != 50*len(test.values) {
+				t.Errorf("%d rows loaded, want %d", rows, 50*len(test.values))
+			}
+		})
+	}
+}
@@ -0,0 +1,67 @@
+package sstable
+
+import (
+	"time"
+
+	"github.com/gocql/gocql"
+)
+
+// TimestampEpoch is the base of the serialization header min timestamp, 2015-09-22 in microseconds.
+const TimestampEpoch int64 = 1442880000000000
+
+// Window is a write time range, bounds included, in microseconds.
+type Window struct {
+	Min int64
+	Max int64
+}
+
+func (w *Window) Contains(t int64) bool {
+	return t >= w.Min && t <= w.Max
+}
+
+// Overlaps return true if some data written between min and max can be in the window.
+func (w *Window) Overlaps(min, max int64) bool {
+	return min <= w.Max && max >= w.Min
+}
+
+func (w *Window) String() string {
+	return time.UnixMicro(w.Min).UTC().Format(time.RFC3339Nano) + " - " + time.UnixMicro(w.Max).UTC().Format(time.RFC3339Nano)
+}
+
+// WriteTime return the timestamp of the row primary key liveness, false if the row has none.
+func (row *Row) WriteTime(schema *Schema) (int64, bool) {
+	if !GetFlag(row.Flags, HasTimestamp) {
+		return 0, false
+	}
+	return schema.MinTimestamp + int64(row.Timestamp), true
+}
+
+// WriteTime return the timestamp of the cell, the row one if shared.
+func (cell *Cell) WriteTime(row *Row, schema *Schema) int64 {
+	if GetFlag(cell.Flags, UseRowTimestamp) {
+		t, _ := row.WriteTime(schema)
+		return t
+	}
+	return schema.MinTimestamp + int64(cell.Timestamp)
+}
+
+// window unset the values of the cells written out of the write time window,
+// the row is kept if its primary key or one of its cells was written in it.
+func (sst *SSTable) window(values []any, r *Row) bool {
+	t, ok := r.WriteTime(&sst.Schema)
+	keep := ok && sst.WriteTime.Contains(t)
+
+	first := len(values) - len(r.Cells)
+	for i := range r.Cells {
+		if values[first+i] == any(&gocql.UnsetValue) {
+			continue
+		}
+		if sst.WriteTime.Contains(r.Cells[i].WriteTime(r, &sst.Schema)) {
+			keep = true
+		} else {
+			values[first+i] = &gocql.UnsetValue
+		}
+	}
+
+	return keep
+}
@@ -0,0 +1,136 @@
+package sstable
+
+import (
+	"context"
+	"encoding/binary"
+	"math"
+	"testing"
+
+	"github.com/gocql/gocql"
+)
+
+func TestWindowOverlaps(t *testing.T) {
+	window := Window{Min: 100, Max: 200}
+	tests := []struct {
+		name     string
+		min, max int64 // sstable write times
+		overlaps bool
+	}{
+		{"before", 10, 99, false},
+		{"after", 201, 300, false},
+		{"ending at min", 10, 100, true},
+		{"starting at max", 200, 300, true},
+		{"inside", 120, 180, true},
+		{"around", 10, 300, true},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if overlaps := window.Overlaps(test.min, test.max); overlaps != test.overlaps {
+				t.Errorf("overlaps %v, want %v", overlaps, test.overlaps)
+			}
+		})
+	}
+
+	// a min write time only skips the sstables written before it
+	since := Window{Min: 100, Max: math.MaxInt64}
+	if since.Overlaps(10, 99) || !since.Overlaps(10, 100) || !since.Overlaps(math.MaxInt64-1, math.MaxInt64) {
+		t.Error("min write time window overlaps")
+	}
+	if !window.Contains(100) || !window.Contains(200) || window.Contains(99) || window.Contains(201) {
+		t.Error("window bounds not included")
+	}
+}
+
+// cellsSchema has a text partition key and a text and an int columns,
+// timestamps relative to 1000us and deletion times to 1000s.
+func cellsSchema() Schema {
+	return Schema{
+		MinTimestamp:         1000,
+		MinLocalDeletionTime: 1000,
+		PartitionKey:         []string{MarshalPrefix + "UTF8Type"},
+		Columns: []SchemaEntry{
+			{Name: "a", Type: MarshalPrefix + "UTF8Type", Size: TextSize},
+			{Name: "b", Type: MarshalPrefix + "Int32Type", Size: Int32Size},
+		},
+	}
+}
+
+// windowRow return a row written at 1000+ts unless 0 for no liveness, of cells a and b written at 1000+their ts,
+// sharing the row timestamp if 0.
+func windowRow(ts, aTS, bTS uint64) Row {
+	row := Row{
+		Cells: []Cell{
+			{TypeSize: TextSize, Timestamp: aTS, Value: []byte("x")},
+			{TypeSize: Int32Size, Timestamp: bTS, Value: binary.BigEndian.AppendUint32(nil, 1)},
+		},
+	}
+	if ts != 0 {
+		row.Flags |= HasTimestamp
+		row.Timestamp = ts
+	}
+	for i := range row.Cells {
+		if row.Cells[i].Timestamp == 0 {
+			row.Cells[i].Flags |= UseRowTimestamp
+		}
+	}
+	return row
+}
+
+func TestWindowRow(t *testing.T) {
+	tests := []struct {
+		name  string
+		row   Row
+		keep  bool
+		unset []bool // cells unset
+	}{
+		{"in window", windowRow(150, 0, 0), true, []bool{false, false}},
+		{"before window", windowRow(50, 0, 0), false, []bool{true, true}},
+		{"after window", windowRow(250, 0, 0), false, []bool{true, true}},
+		{"cell updated in window", windowRow(50, 150, 0), true, []bool{false, true}},
+		{"cell updated after window", windowRow(150, 250, 0), true, []bool{true, false}},
+		{"no liveness, cell in window", windowRow(0, 150, 50), true, []bool{false, true}},
+		{"no liveness, cells out of window", windowRow(0, 50, 250), false, []bool{true, true}},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			sst := New()
+			sst.Schema = cellsSchema()
+			sst.WriteTime = &Window{Min: 1100, Max: 1200}
+			values := sst.values([]any{[]byte("k")}, &test.row)
+			keep := sst.window(values, &test.row)
+			if keep != test.keep {
+				t.Errorf("kept %v, want %v", keep, test.keep)
+			}
+			for i, unset := range test.unset {
+				if (values[1+i] == any(&gocql.UnsetValue)) != unset {
+					t.Errorf("cell %d value %v, want unset %v", i, values[1+i], unset)
+				}
+			}
+		})
+	}
+}
+
+func TestWindowBatches(t *testing.T) {
+	sst := New()
+	sst.Schema = cellsSchema()
+	sst.WriteTime = &Window{Min: 1100, Max: math.MaxInt64}
+	sst.BatchSize = 10
+	sst.BatchBytes = 1 << 20
+
+	partition := &Partition{
+		HeaderKeys: []HeaderKey{{Value: []byte("k")}},
+		Rows:       []Row{windowRow(50, 0, 0), windowRow(150, 0, 0), windowRow(50, 0, 150)},
+	}
+	bt := sst.batcher(context.Background(), make(chan Batch))
+	var rows [][]any
+	for _, b := range bt.batches(partition, Batch{}) {
+		rows = append(rows, b.Rows...)
+	}
+	if len(rows) != 2 || sst.OutOfWindow.Load() != 1 {
+		t.Fatalf("%d rows loaded, %d out of window, want 2 and 1", len(rows), sst.OutOfWindow.Load())
+	}
+	if rows[1][1] != any(&gocql.UnsetValue) || rows[1][2] != int32(1) {
+		t.Errorf("row updated in window %v, want only its updated cell", rows[1])
+	}
+}